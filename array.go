@@ -0,0 +1,110 @@
+package ikea
+
+import (
+	"reflect"
+)
+
+func getArrayHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	h, err := getTypeHandler(t.Elem(), cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectRest(t, h); err != nil {
+		return nil, err
+	}
+
+	// An array of fixed elements has a fixed size, so it can take part in fixed structs
+	if h.isFixed() {
+		a := &fixedArrayReadWriter{typ: t, handler: h.(fixedReadWriter)}
+		if _, raw := h.(*rawReadWriter); raw {
+			return &rawReadWriter{a}, nil
+		}
+		return a, nil
+	}
+
+	return &variableArrayReadWriter{typ: t, handler: h.(variableReadWriter)}, nil
+}
+
+var _ fixedReadWriter = (*fixedArrayReadWriter)(nil)
+
+// fixedArrayReadWriter packs arrays of fixed elements, as the length is part of the type, no prefix is written.
+type fixedArrayReadWriter struct {
+	fixed
+	typ     reflect.Type
+	handler fixedReadWriter
+}
+
+func (a *fixedArrayReadWriter) length() int {
+	return a.typ.Len() * a.handler.length()
+}
+
+func (a *fixedArrayReadWriter) readFixed(data []byte, v reflect.Value) error {
+	l := a.handler.length()
+	for i := 0; i < a.typ.Len(); i++ {
+		if err := a.handler.readFixed(data[i*l:(i+1)*l], v.Index(i)); err != nil {
+			return offsetFieldError(wrapIndexError(err, i, a.typ.Elem(), 0), int64(i*l))
+		}
+	}
+
+	return nil
+}
+
+func (a *fixedArrayReadWriter) writeFixed(data []byte, v reflect.Value) error {
+	l := a.handler.length()
+	for i := 0; i < a.typ.Len(); i++ {
+		if err := a.handler.writeFixed(data[i*l:(i+1)*l], v.Index(i)); err != nil {
+			return offsetFieldError(wrapIndexError(err, i, a.typ.Elem(), 0), int64(i*l))
+		}
+	}
+
+	return nil
+}
+
+var _ variableReadWriter = (*variableArrayReadWriter)(nil)
+
+// variableArrayReadWriter packs arrays of variable elements, as the length is part of the type, no prefix is written.
+type variableArrayReadWriter struct {
+	variable
+	typ     reflect.Type
+	handler variableReadWriter
+}
+
+func (a *variableArrayReadWriter) readVariable(r *reader, v reflect.Value) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	for i := 0; i < a.typ.Len(); i++ {
+		start := r.n
+		if err := a.handler.readVariable(r, v.Index(i)); err != nil {
+			return wrapIndexError(err, i, a.typ.Elem(), start)
+		}
+	}
+
+	return nil
+}
+
+func (a *variableArrayReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	for i := 0; i < a.typ.Len(); i++ {
+		start := w.n
+		if err := a.handler.writeVariable(w, v.Index(i)); err != nil {
+			return wrapIndexError(err, i, a.typ.Elem(), start)
+		}
+	}
+
+	return nil
+}
+
+func (a *variableArrayReadWriter) vLength(v reflect.Value) (int, error) {
+	size := 0
+	for i := 0; i < a.typ.Len(); i++ {
+		l, err := a.handler.vLength(v.Index(i))
+		if err != nil {
+			return 0, wrapIndexError(err, i, a.typ.Elem(), -1)
+		}
+		size += l
+	}
+
+	return size, nil
+}
@@ -0,0 +1,102 @@
+package ikea
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// bitField is a single field of a bitGroupReadWriter.
+type bitField struct {
+	index int
+	name  string
+	typ   reflect.Type
+	bits  int
+}
+
+var _ fixedReadWriter = (*bitGroupReadWriter)(nil)
+
+// bitGroupReadWriter packs consecutive bool and unsigned fields tagged with bits:N into shared bytes.
+// Fields are packed in order, most significant bit first, the remaining bits of the last byte are zero.
+// It operates on the struct holding the fields, rather than on a single field.
+type bitGroupReadWriter struct {
+	fixed
+	fields []bitField
+	bits   int
+}
+
+func (g *bitGroupReadWriter) add(field bitField) {
+	g.fields = append(g.fields, field)
+	g.bits += field.bits
+}
+
+func (g *bitGroupReadWriter) length() int {
+	return (g.bits + 7) / 8
+}
+
+func (g *bitGroupReadWriter) readFixed(b []byte, v reflect.Value) error {
+	pos := 0
+	for _, field := range g.fields {
+		var u uint64
+		for i := 0; i < field.bits; i++ {
+			u = u<<1 | uint64(b[pos/8]>>(7-pos%8)&1)
+			pos++
+		}
+
+		f := v.Field(field.index)
+		if f.Kind() == reflect.Bool {
+			f.SetBool(u != 0)
+		} else {
+			f.SetUint(u)
+		}
+	}
+
+	return nil
+}
+
+func (g *bitGroupReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	pos := 0
+	for _, field := range g.fields {
+		f := v.Field(field.index)
+
+		var u uint64
+		if f.Kind() == reflect.Bool {
+			if f.Bool() {
+				u = 1
+			}
+		} else {
+			u = f.Uint()
+		}
+		if u>>field.bits != 0 {
+			err := fmt.Errorf("%w: %d does not fit in %d bits", ErrOverflow, u, field.bits)
+			return &FieldError{Path: field.name, Type: field.typ, Offset: int64(pos / 8), Err: err}
+		}
+
+		for i := field.bits - 1; i >= 0; i-- {
+			b[pos/8] |= byte(u>>i&1) << (7 - pos%8)
+			pos++
+		}
+	}
+
+	return nil
+}
+
+// parseBits validates the size of a bit field of type t.
+func parseBits(s string, t reflect.Type) (int, error) {
+	var max int
+	switch t.Kind() {
+	case reflect.Bool:
+		max = 1
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		max = t.Bits()
+	default:
+		return 0, fmt.Errorf("bits can only be used on bools and unsigned integers, not %s", t)
+	}
+
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 1 || bits > max {
+		return 0, fmt.Errorf("invalid bit size %q for %s, should be 1 to %d", s, t, max)
+	}
+
+	return bits, nil
+}
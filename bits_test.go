@@ -0,0 +1,101 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type direction uint8
+
+func TestBits(t *testing.T) {
+	type state struct {
+		Alive     bool      `ikea:"bits:1"`
+		Direction direction `ikea:"bits:2"`
+		Team      uint16    `ikea:"bits:6"`
+		Health    uint8
+		Visible   bool `ikea:"bits:1"`
+	}
+
+	h, err := getTypeHandler(reflect.TypeOf(state{}), config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !h.isFixed() || h.(fixedReadWriter).length() != 4 {
+		t.Errorf("Failing TestBits, expected a fixed handler of 4 bytes, got %T", h)
+	}
+
+	value := &state{Alive: true, Direction: 2, Team: 0x2d, Health: 100, Visible: true}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 1 10 101101 -> 1101 0110 1000 0000, followed by the health and 1 -> 1000 0000
+	expected := []byte{0xd6, 0x80, 100, 0x80}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestBits, expected %x, got %x", expected, data)
+	}
+
+	result := new(state)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if *result != *value {
+		t.Errorf("Failing TestBits, expected %+v, got %+v", value, result)
+	}
+
+	var fe *FieldError
+	if _, err := Marshal(&state{Direction: 4}); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Path != "state.Direction" {
+		t.Errorf("Failing TestBits, expected Direction to overflow, got %v", err)
+	}
+
+	var te *InvalidTagError
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(struct {
+			A bool `ikea:"bits:2"`
+		}{}),
+		reflect.TypeOf(struct {
+			A int8 `ikea:"bits:2"`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8 `ikea:"bits:9"`
+		}{}),
+	} {
+		if err := Check(typ); !errors.As(err, &te) {
+			t.Errorf("Failing TestBits, expected %s to be rejected, got %v", typ, err)
+		}
+	}
+}
+
+func TestBitsInVariableStruct(t *testing.T) {
+	type flagged struct {
+		Name  string
+		Read  bool   `ikea:"bits:1"`
+		Write bool   `ikea:"bits:1"`
+		Mode  uint32 `ikea:"bits:12"`
+	}
+
+	value := &flagged{Name: "a", Read: true, Mode: 0x1ff}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 1, 'a', 0x87, 0xfc}) {
+		t.Errorf("Failing TestBitsInVariableStruct, unexpected output %x", data)
+	}
+
+	result := new(flagged)
+	if err := Unmarshal(data, result); err != nil || *result != *value {
+		t.Errorf("Failing TestBitsInVariableStruct, expected %+v, got %+v (%v)", value, result, err)
+	}
+
+	var fe *FieldError
+	if _, err := Marshal(&flagged{Mode: 1 << 12}); !errors.As(err, &fe) || fe.Path != "flagged.Mode" || fe.Offset != 4 {
+		t.Errorf("Failing TestBitsInVariableStruct, expected Mode to overflow at offset 4, got %v", err)
+	}
+}
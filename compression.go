@@ -3,10 +3,7 @@ package ikea
 import (
 	"bytes"
 	"compress/flate"
-	"encoding/binary"
 	"fmt"
-	"io"
-	"math"
 	"reflect"
 )
 
@@ -16,34 +13,51 @@ type compressionReadWriter struct {
 	variable
 	handler readWriter
 	level   int
+	maxOut  int64 // Overrides the MaxDecompressedSize option if above 0
+	prefix  lengthPrefix
+	opts    *options // Used by vLength, so calls to Pack from within a Packer use the same config
 }
 
-func (c *compressionReadWriter) readVariable(r io.Reader, v reflect.Value) (err error) {
-	lb := make([]byte, 4)
-	if _, err := io.ReadFull(r, lb); err != nil {
+func (c *compressionReadWriter) readVariable(r *reader, v reflect.Value) (err error) {
+	l, err := r.readLength(c.prefix, "compressed blob", 0, nil)
+	if err != nil {
 		return err
 	}
 
-	ul := binary.BigEndian.Uint32(lb)
-	if ul > math.MaxInt32 {
-		return fmt.Errorf("transmitted compressed blob too large (%d>%d)", ul, math.MaxInt32)
-	}
-	l := int(ul)
-
-	cb := make([]byte, l)
-	if _, err := io.ReadFull(r, cb); err != nil {
+	// The inner handler reads from its own reader, so the scratch buffer won't be reused while inflating
+	cb, err := r.next(l)
+	if err != nil {
 		return err
 	}
 
-	z := flate.NewReader(bytes.NewBuffer(cb))
+	z := flate.NewReader(bytes.NewReader(cb))
 	defer func() {
 		_ = z.Close() // Memory buffer, can never error
 	}()
 
-	return handleVariableReader(z, c.handler, v)
+	limit, limitErr := c.outputLimit(r.opts, int64(l))
+	return handleVariableReader(r.child(z, limit, limitErr), c.handler, v)
 }
 
-func (c *compressionReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
+// outputLimit determines how many bytes a compressed blob of size l may inflate to, and the error to return if it
+// does inflate further. The lowest of the size and ratio limits applies.
+func (c *compressionReadWriter) outputLimit(opts *options, l int64) (int64, error) {
+	maxOut := opts.maxDecompressed
+	if c.maxOut > 0 {
+		maxOut = c.maxOut
+	}
+
+	if ratio := opts.maxCompressRatio; ratio > 0 && (maxOut == 0 || l*ratio < maxOut) {
+		return l * ratio, fmt.Errorf("%w (%d:1)", ErrCompressionRatio, ratio)
+	}
+	if maxOut > 0 {
+		return maxOut, fmt.Errorf("%w (%d bytes)", ErrDecompressedTooLarge, maxOut)
+	}
+
+	return 0, nil
+}
+
+func (c *compressionReadWriter) writeVariable(w *writer, v reflect.Value) error {
 	var b bytes.Buffer
 
 	z, err := flate.NewWriter(&b, c.level)
@@ -51,12 +65,13 @@ func (c *compressionReadWriter) writeVariable(w io.Writer, v reflect.Value) erro
 		return err
 	}
 
-	_ = handleVariableWriter(z, c.handler, v) // As we are using a memory buffer, these two calls can never err
+	// As we are using a memory buffer, only the handler itself can cause errors here
+	if err = handleVariableWriter(w.child(z), c.handler, v); err != nil {
+		return err
+	}
 	_ = z.Close()
 
-	lb := make([]byte, 4)
-	binary.BigEndian.PutUint32(lb, uint32(b.Len()))
-	if _, err = w.Write(lb); err != nil {
+	if err = w.writeLength(c.prefix, b.Len()); err != nil {
 		return err
 	}
 	if _, err = w.Write(b.Bytes()); err != nil {
@@ -66,8 +81,8 @@ func (c *compressionReadWriter) writeVariable(w io.Writer, v reflect.Value) erro
 	return nil
 }
 
-func (c *compressionReadWriter) vLength(v reflect.Value) int {
+func (c *compressionReadWriter) vLength(v reflect.Value) (int, error) {
 	var b bytes.Buffer
-	_ = c.writeVariable(&b, v)
-	return b.Len()
+	err := c.writeVariable(&writer{w: &b, opts: c.opts}, v)
+	return b.Len(), err
 }
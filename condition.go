@@ -0,0 +1,241 @@
+package ikea
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// condition is a parsed if tag, like `ikea:"if:Flags&0x04"` or `ikea:"if:Version>=2 && Kind!=3"`.
+// It is a tree of integer expressions over earlier fields of the same struct, a field is present if it evaluates to
+// anything but 0. Supported are integer literals, field names, parentheses and the operators ! & | == != < <= > >= &&
+// and ||, in order of precedence. Bools evaluate to 0 or 1.
+type condition struct {
+	op    string // Empty for literals and fields
+	value int64
+	field string
+	ref   fieldRef
+	args  []*condition
+}
+
+// fieldRef locates a field referenced by a condition.
+type fieldRef struct {
+	index int // The index of the field within its struct
+	pos   int // The position of the field within the packed fields, or -1 for bit fields
+}
+
+func parseCondition(s string) (*condition, error) {
+	p := &conditionParser{input: s}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	c, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, fmt.Errorf("unexpected %q in condition %q", p.token, s)
+	}
+
+	return c, nil
+}
+
+// binaryOperators holds the binary operators per level of precedence, from lowest to highest.
+var binaryOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"|"},
+	{"&"},
+}
+
+type conditionParser struct {
+	input string
+	pos   int
+	token string
+}
+
+// next moves to the next token, which is empty at the end of the input.
+func (p *conditionParser) next() error {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.input) {
+		p.token = ""
+		return nil
+	}
+
+	start := p.pos
+	c := rune(p.input[p.pos])
+	switch {
+	case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+		for p.pos < len(p.input) {
+			c = rune(p.input[p.pos])
+			if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			p.pos++
+		}
+	case strings.HasPrefix(p.input[p.pos:], "||"), strings.HasPrefix(p.input[p.pos:], "&&"),
+		strings.HasPrefix(p.input[p.pos:], "=="), strings.HasPrefix(p.input[p.pos:], "!="),
+		strings.HasPrefix(p.input[p.pos:], "<="), strings.HasPrefix(p.input[p.pos:], ">="):
+		p.pos += 2
+	case strings.ContainsRune("!&|<>()", c):
+		p.pos++
+	default:
+		return fmt.Errorf("unexpected character %q in condition %q", c, p.input)
+	}
+
+	p.token = p.input[start:p.pos]
+	return nil
+}
+
+func (p *conditionParser) parseBinary(level int) (*condition, error) {
+	if level == len(binaryOperators) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for isOperator(p.token, binaryOperators[level]) {
+		op := p.token
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &condition{op: op, args: []*condition{left, right}}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (*condition, error) {
+	token := p.token
+	if token == "" {
+		return nil, fmt.Errorf("unexpected end of condition %q", p.input)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	switch c := rune(token[0]); {
+	case token == "!":
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condition{op: "!", args: []*condition{arg}}, nil
+	case token == "(":
+		c, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, fmt.Errorf("missing ) in condition %q", p.input)
+		}
+		return c, p.next()
+	case unicode.IsDigit(c):
+		value, err := strconv.ParseInt(token, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in condition %q", token, p.input)
+		}
+		return &condition{value: value}, nil
+	case c == '_' || unicode.IsLetter(c):
+		return &condition{field: token}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q in condition %q", token, p.input)
+	}
+}
+
+func isOperator(token string, operators []string) bool {
+	for _, op := range operators {
+		if token == op {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve looks up the fields referenced by c, using lookup which returns false if there is no such field.
+func (c *condition) resolve(lookup func(name string) (fieldRef, bool)) error {
+	if c.field != "" {
+		ref, ok := lookup(c.field)
+		if !ok {
+			return fmt.Errorf("condition refers to %s, which is not an earlier integer or bool field", c.field)
+		}
+		c.ref = ref
+	}
+
+	for _, arg := range c.args {
+		if err := arg.resolve(lookup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eval evaluates c, get returns the value of a referenced field.
+func (c *condition) eval(get func(fieldRef) reflect.Value) int64 {
+	switch c.op {
+	case "":
+		if c.field == "" {
+			return c.value
+		}
+		return conditionValue(get(c.ref))
+	case "!":
+		return boolValue(c.args[0].eval(get) == 0)
+	case "&&":
+		return boolValue(c.args[0].eval(get) != 0 && c.args[1].eval(get) != 0)
+	case "||":
+		return boolValue(c.args[0].eval(get) != 0 || c.args[1].eval(get) != 0)
+	}
+
+	a, b := c.args[0].eval(get), c.args[1].eval(get)
+	switch c.op {
+	case "&":
+		return a & b
+	case "|":
+		return a | b
+	case "==":
+		return boolValue(a == b)
+	case "!=":
+		return boolValue(a != b)
+	case "<":
+		return boolValue(a < b)
+	case "<=":
+		return boolValue(a <= b)
+	case ">":
+		return boolValue(a > b)
+	default: // ">="
+		return boolValue(a >= b)
+	}
+}
+
+func conditionValue(v reflect.Value) int64 {
+	switch {
+	case v.Kind() == reflect.Bool:
+		return boolValue(v.Bool())
+	case isSigned(v.Kind()):
+		return v.Int()
+	default:
+		return int64(v.Uint())
+	}
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConditionalFields(t *testing.T) {
+	type header struct {
+		Version  uint8
+		Flags    uint8
+		Extended bool   `ikea:"bits:1"`
+		Checksum uint32 `ikea:"if:Flags&0x04"`
+		Name     string `ikea:"if:Version>=2 && !(Flags & 0x01)"`
+		Extra    uint16 `ikea:"if:Extended || Version == 0x10"`
+	}
+
+	tests := []struct {
+		value    header
+		expected []byte
+	}{
+		{header{Version: 1, Flags: 0x04, Checksum: 7}, []byte{1, 4, 0, 0, 0, 0, 7}},
+		{header{Version: 2, Flags: 0x01}, []byte{2, 1, 0}},
+		{header{Version: 2, Name: "a"}, []byte{2, 0, 0, 0, 0, 0, 1, 'a'}},
+		{header{Version: 1, Extended: true, Extra: 3}, []byte{1, 0, 0x80, 0, 3}},
+	}
+
+	for _, test := range tests {
+		data, err := Marshal(&test.value)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("Failing TestConditionalFields, expected %x, got %x", test.expected, data)
+		}
+		if l, err := Len(&test.value); err != nil || l != len(data) {
+			t.Errorf("Failing TestConditionalFields, Len reported %d, should be %d (%v)", l, len(data), err)
+		}
+
+		// Absent fields are reset, even if the target held a value before
+		result := &header{Checksum: 1, Name: "stale", Extra: 1}
+		if err := Unmarshal(data, result); err != nil {
+			t.Error(err)
+			continue
+		}
+		if *result != test.value {
+			t.Errorf("Failing TestConditionalFields, expected %+v, got %+v", test.value, result)
+		}
+	}
+
+	// Fields that are absent are not packed, even if they hold a value
+	data, err := Marshal(&header{Version: 1, Checksum: 9, Name: "x"})
+	if err != nil || !bytes.Equal(data, []byte{1, 0, 0}) {
+		t.Errorf("Failing TestConditionalFields, expected absent fields to be skipped, got %x (%v)", data, err)
+	}
+}
+
+func TestConditionalCount(t *testing.T) {
+	type message struct {
+		Count uint8
+		Items []uint8 `ikea:"count:Count"`
+		More  uint8   `ikea:"if:Count > 1"`
+	}
+
+	// Count is filled in when packing, which the condition should take into account
+	data, err := Marshal(&message{Items: []uint8{1, 2}, More: 3})
+	if err != nil || !bytes.Equal(data, []byte{2, 1, 2, 3}) {
+		t.Errorf("Failing TestConditionalCount, unexpected output %x (%v)", data, err)
+	}
+}
+
+func TestInvalidConditions(t *testing.T) {
+	var te *InvalidTagError
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(struct {
+			A uint8 `ikea:"if:B"`
+			B uint8
+		}{}),
+		reflect.TypeOf(struct {
+			A string
+			B uint8 `ikea:"if:A"`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8
+			B uint8 `ikea:"if:(A"`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8
+			B uint8 `ikea:"if:A+1"`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8
+			B uint8 `ikea:"if:A 1"`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8
+			B uint8 `ikea:"if:A=="`
+		}{}),
+		reflect.TypeOf(struct {
+			A uint8
+			B uint8 `ikea:"if:0xZZ"`
+		}{}),
+	} {
+		if err := Check(typ); !errors.As(err, &te) {
+			t.Errorf("Failing TestInvalidConditions, expected %s to be rejected, got %v", typ, err)
+		}
+	}
+}
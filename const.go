@@ -0,0 +1,64 @@
+package ikea
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ErrConstMismatch is returned when a field tagged with const holds a different value when unpacking.
+var ErrConstMismatch = errors.New("ikea: constant mismatch")
+
+// parseConst parses the value of a const tag for a field of type t.
+func parseConst(s string, t reflect.Type) (reflect.Value, error) {
+	if !isInteger(t.Kind()) {
+		return reflect.Value{}, fmt.Errorf("const can only be used on integers, not %s", t)
+	}
+
+	v := reflect.New(t).Elem()
+	if isSigned(t.Kind()) {
+		n, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid const %q for %s", s, t)
+		}
+		v.SetInt(n)
+	} else {
+		n, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid const %q for %s", s, t)
+		}
+		v.SetUint(n)
+	}
+
+	return v, nil
+}
+
+var _ fixedReadWriter = (*constReadWriter)(nil)
+
+// constReadWriter always packs value, and verifies the field holds that value when unpacking.
+// As it never reads the field when packing, it can be used on blank fields.
+type constReadWriter struct {
+	fixedReadWriter
+	value reflect.Value
+}
+
+func (c *constReadWriter) readFixed(b []byte, v reflect.Value) error {
+	got := reflect.New(c.value.Type()).Elem()
+	if err := c.fixedReadWriter.readFixed(b, got); err != nil {
+		return err
+	}
+
+	if got.Interface() != c.value.Interface() {
+		return fmt.Errorf("%w: expected %#x, got %#x", ErrConstMismatch, c.value.Interface(), got.Interface())
+	}
+	if v.CanSet() {
+		v.Set(got)
+	}
+
+	return nil
+}
+
+func (c *constReadWriter) writeFixed(b []byte, _ reflect.Value) error {
+	return c.fixedReadWriter.writeFixed(b, c.value)
+}
@@ -0,0 +1,82 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConst(t *testing.T) {
+	type header struct {
+		_       uint32 `ikea:"const:0xCAFEBABE"`
+		Version int16  `ikea:"const:-2"`
+		Size    uint16
+	}
+
+	h, err := getTypeHandler(reflect.TypeOf(header{}), config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !h.isFixed() || h.(fixedReadWriter).length() != 8 {
+		t.Errorf("Failing TestConst, expected a fixed handler of 8 bytes, got %T", h)
+	}
+
+	data, err := Marshal(&header{Size: 3})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{0xCA, 0xFE, 0xBA, 0xBE, 0xFF, 0xFE, 0, 3}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestConst, expected %x, got %x", expected, data)
+	}
+
+	result := new(header)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Version != -2 || result.Size != 3 {
+		t.Errorf("Failing TestConst, unexpected result %+v", result)
+	}
+
+	var fe *FieldError
+	data[1] = 0
+	if err := Unmarshal(data, result); !errors.Is(err, ErrConstMismatch) || !errors.As(err, &fe) || fe.Path != "header._" || fe.Offset != 0 {
+		t.Errorf("Failing TestConst, expected a mismatch on the magic, got %v", err)
+	}
+	data[1], data[5] = 0xFE, 1
+	if err := Unmarshal(data, result); !errors.Is(err, ErrConstMismatch) || !errors.As(err, &fe) || fe.Path != "header.Version" || fe.Offset != 4 {
+		t.Errorf("Failing TestConst, expected a mismatch on Version, got %v", err)
+	}
+
+	// Blank fields without a const are still ignored
+	if l, err := Len(&struct {
+		_ uint64
+		A uint8
+	}{}); err != nil || l != 1 {
+		t.Errorf("Failing TestConst, expected a blank field to be ignored, got %d (%v)", l, err)
+	}
+
+	for _, v := range []interface{}{
+		struct {
+			A uint8 `ikea:"const:256"`
+		}{},
+		struct {
+			A string `ikea:"const:1"`
+		}{},
+		struct {
+			A uint32 `ikea:"const:1,varint"`
+		}{},
+		struct {
+			A uint32 `ikea:"const"`
+		}{},
+	} {
+		var te *InvalidTagError
+		if err := Check(reflect.TypeOf(v)); !errors.As(err, &te) {
+			t.Errorf("Failing TestConst, expected %T to be rejected, got %v", v, err)
+		}
+	}
+}
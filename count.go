@@ -0,0 +1,206 @@
+package ikea
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// lengthRef links a field holding a count or size to the field it describes, by their positions within the packed
+// fields of their struct.
+type lengthRef struct {
+	counter, counted int
+	bytes            bool // The counter holds the packed size in bytes, rather than the amount of elements
+}
+
+func getCountedHandler(t reflect.Type, cfg config, bytes bool) (*countedReadWriter, error) {
+	c := &countedReadWriter{typ: t, bytes: bytes}
+	if isByteString(t) {
+		c.str = t.Kind() == reflect.String
+		return c, nil
+	}
+
+	h, err := getTypeHandler(t.Elem(), cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectRest(t, h); err != nil {
+		return nil, err
+	}
+	c.slice = &sliceReadWriter{typ: t, handler: h, rejectNil: cfg.nilPolicy(t) == NilError}
+	return c, nil
+}
+
+var _ variableReadWriter = (*countedReadWriter)(nil)
+
+// countedReadWriter packs strings and slices without a length prefix, as their length is held by an earlier field of
+// the same struct. Unpacking is done by the struct using readCounted, which passes the length.
+type countedReadWriter struct {
+	variable
+	typ   reflect.Type
+	str   bool
+	slice *sliceReadWriter // nil for strings and byte slices
+	bytes bool
+}
+
+func (c *countedReadWriter) readVariable(*reader, reflect.Value) error {
+	return fmt.Errorf("ikea: the length of %s is unknown", c.typ)
+}
+
+// readCounted reads v, of which the length is l.
+func (c *countedReadWriter) readCounted(r *reader, v reflect.Value, l int) error {
+	if c.slice == nil {
+		max, limitErr := r.opts.maxSliceLength, ErrSliceTooLong
+		if c.str {
+			max, limitErr = r.opts.maxStringLength, ErrStringTooLong
+		}
+		if max > 0 && l > max {
+			return fmt.Errorf("%w (%d>%d)", limitErr, l, max)
+		}
+
+		b, err := r.next(l)
+		if err != nil {
+			return err
+		}
+		return setByteString(v, b, c.str)
+	}
+
+	if c.bytes {
+		if !c.slice.handler.isFixed() {
+			return c.readSized(r, v, l)
+		}
+
+		// The amount of fixed elements follows from the size
+		size := c.slice.handler.(fixedReadWriter).length()
+		if size == 0 || l%size != 0 {
+			return fmt.Errorf("size of %d bytes is not a multiple of the element size %d", l, size)
+		}
+		l /= size
+	}
+
+	if max := r.opts.maxSliceLength; max > 0 && l > max {
+		return fmt.Errorf("%w (%d>%d)", ErrSliceTooLong, l, max)
+	}
+	return c.slice.readElements(r, v, l)
+}
+
+// readSized reads elements of variable size into v, until exactly size bytes have been read.
+func (c *countedReadWriter) readSized(r *reader, v reflect.Value, size int) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	// Limit the reader to the end of the elements, so the last element can't read beyond it
+	end := r.n + int64(size)
+	limit, limitErr := r.limit, r.limitErr
+	if limit == 0 || end < limit {
+		r.limit, r.limitErr = end, fmt.Errorf("elements exceed their size of %d bytes", size)
+	}
+	defer func() {
+		r.limit, r.limitErr = limit, limitErr
+	}()
+
+	slice := reflect.MakeSlice(c.typ, 0, 0)
+	h := c.slice.handler.(variableReadWriter)
+	for i := 0; r.n < end; i++ {
+		if max := r.opts.maxSliceLength; max > 0 && i >= max {
+			return fmt.Errorf("%w (>%d)", ErrSliceTooLong, max)
+		}
+
+		start := r.n
+		elem := reflect.New(c.typ.Elem()).Elem()
+		if err := h.readVariable(r, elem); err != nil {
+			return wrapIndexError(err, i, c.typ.Elem(), start)
+		}
+		if r.n == start {
+			return wrapIndexError(errors.New("element of size 0 can't fill a size"), i, c.typ.Elem(), start)
+		}
+		slice = reflect.Append(slice, elem)
+	}
+
+	v.Set(slice)
+	return nil
+}
+
+func (c *countedReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if c.slice == nil {
+		var err error
+		if c.str {
+			_, err = w.Write([]byte(v.String()))
+		} else {
+			_, err = w.Write(v.Bytes())
+		}
+		return err
+	}
+
+	if c.slice.rejectNil && v.IsNil() {
+		return &NilValueError{Type: c.typ}
+	}
+	return c.slice.writeElements(w, v)
+}
+
+func (c *countedReadWriter) vLength(v reflect.Value) (int, error) {
+	if c.slice == nil {
+		return v.Len(), nil
+	}
+
+	if c.slice.rejectNil && v.IsNil() {
+		return 0, &NilValueError{Type: c.typ}
+	}
+	return c.slice.elementsLength(v)
+}
+
+// length returns the value the counter of v should hold.
+func (c *countedReadWriter) length(v reflect.Value) (int, error) {
+	if c.bytes {
+		return c.vLength(v)
+	}
+	return v.Len(), nil
+}
+
+// counterValue returns the length held by counter v.
+func counterValue(v reflect.Value) (int, error) {
+	if isSigned(v.Kind()) {
+		if n := v.Int(); n < 0 || n > math.MaxInt32 {
+			return 0, fmt.Errorf("transmitted length %d out of range", n)
+		}
+		return int(v.Int()), nil
+	}
+
+	if n := v.Uint(); n > math.MaxInt32 {
+		return 0, fmt.Errorf("transmitted length %d out of range", n)
+	}
+	return int(v.Uint()), nil
+}
+
+// counterFor returns the value to pack for counter field v, which is the length of the field it describes if v is
+// zero. Otherwise, v is verified to hold that length.
+func counterFor(v reflect.Value, counted *structField, s reflect.Value) (reflect.Value, error) {
+	l, err := counted.handler.(*countedReadWriter).length(counted.value(s))
+	if err != nil {
+		return v, nil // Reported by the counted field itself
+	}
+
+	if v.IsZero() {
+		c := reflect.New(v.Type()).Elem()
+		if isSigned(c.Kind()) {
+			if c.OverflowInt(int64(l)) {
+				return v, fmt.Errorf("%w: length %d of %s does not fit in %s", ErrOverflow, l, counted.name, c.Type())
+			}
+			c.SetInt(int64(l))
+		} else {
+			if c.OverflowUint(uint64(l)) {
+				return v, fmt.Errorf("%w: length %d of %s does not fit in %s", ErrOverflow, l, counted.name, c.Type())
+			}
+			c.SetUint(uint64(l))
+		}
+		return c, nil
+	}
+
+	if n, err := counterValue(v); err != nil || n != l {
+		return v, fmt.Errorf("%v does not match the length of %s (%d)", v, counted.name, l)
+	}
+	return v, nil
+}
@@ -0,0 +1,140 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	type message struct {
+		NumItems uint8
+		Version  uint16
+		NameLen  uint16
+		Items    []uint16 `ikea:"count:NumItems"`
+		Name     string   `ikea:"count:NameLen"`
+	}
+
+	value := &message{Version: 1, Items: []uint16{5, 6}, Name: "ab"}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{2, 0, 1, 0, 2, 0, 5, 0, 6, 'a', 'b'}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestCount, expected %x, got %x", expected, data)
+	}
+	if l, err := Len(value); err != nil || l != len(expected) {
+		t.Errorf("Failing TestCount, Len reported %d, should be %d (%v)", l, len(expected), err)
+	}
+	if value.NumItems != 0 {
+		t.Error("Failing TestCount, the packed value should not have been modified")
+	}
+
+	result := new(message)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	value.NumItems, value.NameLen = 2, 2
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestCount, expected %+v, got %+v", value, result)
+	}
+
+	// A set counter is verified instead
+	var fe *FieldError
+	value.NumItems = 3
+	if _, err := Marshal(value); !errors.As(err, &fe) || fe.Path != "message.NumItems" {
+		t.Errorf("Failing TestCount, expected a mismatch on NumItems, got %v", err)
+	}
+	value.NumItems = 0
+	value.Items = make([]uint16, 256)
+	if _, err := Marshal(value); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Failing TestCount, expected 256 items to overflow NumItems, got %v", err)
+	}
+
+	if err := Unmarshal([]byte{200, 0, 1, 0, 0}, new(message), MaxSliceLength(100)); !errors.Is(err, ErrSliceTooLong) {
+		t.Errorf("Failing TestCount, expected the slice limit to apply, got %v", err)
+	}
+
+	var te *InvalidTagError
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(struct {
+			A []uint8 `ikea:"count:N"`
+			N uint8
+		}{}),
+		reflect.TypeOf(struct {
+			N string
+			A []uint8 `ikea:"count:N"`
+		}{}),
+		reflect.TypeOf(struct {
+			N uint8
+			A []uint8 `ikea:"count:N"`
+			B []uint8 `ikea:"size:N"`
+		}{}),
+		reflect.TypeOf(struct {
+			Flags uint8
+			N     uint8
+			A     []uint8 `ikea:"count:N,if:Flags&1"`
+		}{}),
+		reflect.TypeOf(struct {
+			Flags uint8
+			N     uint8
+			A     []uint8 `ikea:"size:N,if:Flags&1"`
+		}{}),
+	} {
+		if err := Check(typ); !errors.As(err, &te) {
+			t.Errorf("Failing TestCount, expected %s to be rejected, got %v", typ, err)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	type packet struct {
+		PayloadLen uint32
+		Names      []string `ikea:"size:PayloadLen"`
+		Trailer    uint8
+	}
+
+	value := &packet{Names: []string{"a", "bc"}, Trailer: 9}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{0, 0, 0, 11, 0, 0, 0, 1, 'a', 0, 0, 0, 2, 'b', 'c', 9}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestSize, expected %x, got %x", expected, data)
+	}
+
+	result := new(packet)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	value.PayloadLen = 11
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestSize, expected %+v, got %+v", value, result)
+	}
+
+	// The size ends halfway through the second name, which should not be read beyond it
+	data[3] = 10
+	var fe *FieldError
+	if err := Unmarshal(data, new(packet)); !errors.As(err, &fe) || fe.Path != "packet.Names[1]" {
+		t.Errorf("Failing TestSize, expected an error on Names[1], got %v", err)
+	}
+
+	type fixedSize struct {
+		Size   uint8
+		Values []uint16 `ikea:"size:Size"`
+	}
+	if err := Unmarshal([]byte{3, 0, 1, 0}, new(fixedSize)); err == nil {
+		t.Error("Failing TestSize, a size that is not a multiple of the element size should fail")
+	}
+	fs := new(fixedSize)
+	if err := Unmarshal([]byte{4, 0, 1, 0, 2}, fs); err != nil || !reflect.DeepEqual(fs.Values, []uint16{1, 2}) {
+		t.Errorf("Failing TestSize, unexpected result %+v (%v)", fs, err)
+	}
+}
@@ -0,0 +1,194 @@
+package ikea
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Decoder reads packed values from a stream, reusing its internal buffers between calls.
+// A Decoder is not safe for concurrent use.
+type Decoder struct {
+	r reader
+}
+
+// NewDecoder returns a Decoder that reads from r, configured using opts.
+// No more bytes will be read from r than are required to fill the decoded values.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	return &Decoder{r: reader{r: r, opts: newOptions(opts)}}
+}
+
+// Decode will read the next value from the stream into the value passed to data.
+// If the stream ends exactly before the value, io.EOF is returned. If it ends halfway through the value,
+// io.ErrUnexpectedEOF is returned instead.
+// if data is not a non-nil pointer Decode will return an *InvalidUnpackError
+func (d *Decoder) Decode(data interface{}) error {
+	return decode(&d.r, data)
+}
+
+// Offset returns the amount of bytes read since the Decoder was created or last Reset.
+func (d *Decoder) Offset() int64 {
+	return d.r.n
+}
+
+// Reset discards the state of the Decoder and makes it read from r, its buffers are retained.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r.r = r
+	d.r.n = 0
+}
+
+func decode(r *reader, data interface{}) error {
+	pv := reflect.ValueOf(data)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() {
+		return &InvalidUnpackError{Type: reflect.TypeOf(data)}
+	}
+
+	v := pv.Elem()
+	h, err := getTypeHandler(v.Type(), r.opts.cfg)
+	if err != nil {
+		return err
+	}
+
+	start := r.n
+	if r.calls == 0 && r.opts.maxBytes > 0 {
+		r.limit = start + r.opts.maxBytes
+		r.limitErr = fmt.Errorf("%w (%d bytes)", ErrMessageTooLarge, r.opts.maxBytes)
+	}
+
+	r.calls++
+	err = handleVariableReader(r, h, v)
+	r.calls--
+	if r.calls == 0 {
+		r.limit, r.depth = 0, 0
+	}
+	if err == nil {
+		return nil
+	}
+
+	if r.n == start && errors.Is(err, io.EOF) {
+		return io.EOF // Nothing was read at all, so the stream ended cleanly
+	}
+	if fe, ok := err.(*FieldError); ok && fe.Err == io.EOF {
+		fe.Err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return withRoot(err, v.Type(), r.calls)
+}
+
+var _ io.Reader = (*reader)(nil)
+
+// reader wraps the source stream of a decode, it keeps track of the offset and holds a scratch buffer.
+type reader struct {
+	r     io.Reader
+	opts  *options
+	buf   []byte
+	n     int64
+	limit int64 // The offset at which the limit is exceeded, or 0 if there is no limit
+	// limitErr is returned when limit is exceeded, which is ErrMessageTooLarge for the outermost reader
+	limitErr error
+	depth    int
+	calls    int // The amount of decode calls in progress, custom Unpackers may call Unpack with this reader
+}
+
+func readerFor(r io.Reader, opts []Option) *reader {
+	// Custom Unpackers may pass our reader back into Unpack, keep using it so the offset and limits stay intact
+	if rr, ok := r.(*reader); ok {
+		return rr
+	}
+
+	return &reader{r: r, opts: newOptions(opts)}
+}
+
+// child returns a reader for a nested stream, such as a compressed field, that shares the options and depth of r.
+// If limit is above 0, reading more than limit bytes from the child results in limitErr.
+func (r *reader) child(src io.Reader, limit int64, limitErr error) *reader {
+	return &reader{r: src, opts: r.opts, depth: r.depth, limit: limit, limitErr: limitErr}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.limit > 0 && r.n+int64(len(p)) > r.limit {
+		if r.n >= r.limit {
+			return 0, r.limitErr
+		}
+		p = p[:r.limit-r.n]
+	}
+
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// next reads exactly l bytes, the returned slice is only valid until the next call to next.
+func (r *reader) next(l int) ([]byte, error) {
+	// Check the limit before allocating, so a corrupt length can't make us allocate more than the limit
+	if r.limit > 0 && r.n+int64(l) > r.limit {
+		return nil, r.limitErr
+	}
+
+	if cap(r.buf) >= l || l <= preallocBytes {
+		if cap(r.buf) < l {
+			r.buf = make([]byte, l)
+		}
+		b := r.buf[:l]
+
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	// Large reads grow the buffer as the bytes arrive, so a corrupt length in a stream without a limit, such as a
+	// compressed field, can't make us allocate much more than the stream holds
+	b := r.buf[:0]
+	for len(b) < l {
+		n := l - len(b)
+		if step := len(b) + preallocBytes; n > step {
+			n = step
+		}
+		if cap(b) < len(b)+n {
+			grown := make([]byte, len(b), len(b)+n)
+			copy(grown, b)
+			b = grown
+		}
+		if _, err := io.ReadFull(r, b[len(b):len(b)+n]); err != nil {
+			return nil, err
+		}
+		b = b[:len(b)+n]
+	}
+
+	r.buf = b
+	return b, nil
+}
+
+// preallocBytes is the amount of bytes, or elements, that may be allocated before any of them have been read.
+const preallocBytes = 64 * 1024
+
+// capacity returns how many of l variable sized elements to allocate up front. This is capped by preallocBytes and
+// the bytes left before the limit, so a corrupt length can't make us allocate much more than the stream holds.
+// Collections grow beyond that as their elements are read.
+func (r *reader) capacity(l int) int {
+	if l > preallocBytes {
+		l = preallocBytes
+	}
+	if r.limit > 0 && int64(l) > r.limit-r.n {
+		l = int(r.limit - r.n)
+	}
+	return l
+}
+
+// enter increases the nesting depth, which has to be decreased again using leave.
+func (r *reader) enter() error {
+	if r.opts.maxDepth > 0 && r.depth >= r.opts.maxDepth {
+		return fmt.Errorf("%w (%d)", ErrTooDeep, r.opts.maxDepth)
+	}
+
+	r.depth++
+	return nil
+}
+
+func (r *reader) leave() {
+	r.depth--
+}
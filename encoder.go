@@ -0,0 +1,103 @@
+package ikea
+
+import (
+	"io"
+	"reflect"
+)
+
+// Encoder writes packed values to a stream, reusing its internal buffers between calls.
+// An Encoder is not safe for concurrent use.
+type Encoder struct {
+	w writer
+}
+
+// NewEncoder returns an Encoder that writes to w, configured using opts.
+func NewEncoder(w io.Writer, opts ...Option) *Encoder {
+	return &Encoder{w: writer{w: w, opts: newOptions(opts)}}
+}
+
+// Encode will write the value passed in data to the stream.
+func (e *Encoder) Encode(data interface{}) error {
+	return encode(&e.w, data)
+}
+
+// Offset returns the amount of bytes written since the Encoder was created or last Reset.
+func (e *Encoder) Offset() int64 {
+	return e.w.n
+}
+
+// Reset discards the state of the Encoder and makes it write to w, its buffers are retained.
+func (e *Encoder) Reset(w io.Writer) {
+	e.w.w = w
+	e.w.n = 0
+}
+
+func encode(w *writer, data interface{}) error {
+	h, v, err := handlerForValue(data, w.opts)
+	if err != nil {
+		return err
+	}
+
+	w.calls++
+	err = handleVariableWriter(w, h, v)
+	w.calls--
+
+	return withRoot(err, v.Type(), w.calls)
+}
+
+// handlerForValue dereferences data and looks up its handler, data may not be nil.
+func handlerForValue(data interface{}, opts *options) (readWriter, reflect.Value, error) {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil, v, &NilValueError{Type: reflect.TypeOf(data)}
+	}
+	v = addressable(reflect.Indirect(v))
+
+	h, err := getTypeHandler(v.Type(), opts.cfg)
+	return h, v, err
+}
+
+var _ io.Writer = (*writer)(nil)
+
+// writer wraps the target stream of an encode, it keeps track of the offset and holds a scratch buffer.
+type writer struct {
+	w     io.Writer
+	opts  *options
+	buf   []byte
+	n     int64
+	calls int // The amount of encode calls in progress, custom Packers may call Pack with this writer
+}
+
+func writerFor(w io.Writer, opts []Option) *writer {
+	// Custom Packers may pass our writer back into Pack, keep using it so the offset and options stay intact
+	if ww, ok := w.(*writer); ok {
+		return ww
+	}
+
+	return &writer{w: w, opts: newOptions(opts)}
+}
+
+// child returns a writer for a nested stream, such as a compressed field, that shares the options of w.
+func (w *writer) child(dst io.Writer) *writer {
+	return &writer{w: dst, opts: w.opts}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// scratch returns a zeroed slice of l bytes, which is only valid until the next call to scratch.
+func (w *writer) scratch(l int) []byte {
+	if cap(w.buf) < l {
+		w.buf = make([]byte, l)
+	}
+	b := w.buf[:l]
+
+	for i := range b {
+		b[i] = 0
+	}
+
+	return b
+}
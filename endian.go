@@ -0,0 +1,91 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"reflect"
+	"unsafe"
+)
+
+// Endianness selects the byte order in which numbers are packed, see the ByteOrder option.
+type Endianness uint8
+
+const (
+	// BigEndian packs numbers with their most significant byte first, which is the default.
+	BigEndian Endianness = iota
+	// LittleEndian packs numbers with their least significant byte first.
+	LittleEndian
+	// NativeEndian packs numbers in the byte order of the current machine, which allows fixed structs and slices of
+	// numbers to be copied directly from and into memory. This is only meant for communication on the same machine.
+	NativeEndian
+)
+
+var nativeOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+func (e Endianness) byteOrder() binary.ByteOrder {
+	switch e {
+	case LittleEndian:
+		return binary.LittleEndian
+	case NativeEndian:
+		return nativeOrder
+	default:
+		return binary.BigEndian
+	}
+}
+
+var _ fixedReadWriter = (*rawReadWriter)(nil)
+
+// rawReadWriter copies values directly from and into memory, which is only used with NativeEndian for types of
+// which the memory layout is equal to their packed form. Values that are not addressable are passed to the
+// wrapped handler instead.
+type rawReadWriter struct {
+	fixedReadWriter
+}
+
+func (r *rawReadWriter) readFixed(b []byte, v reflect.Value) error {
+	if !v.CanAddr() {
+		return r.fixedReadWriter.readFixed(b, v)
+	}
+	copy(rawBytes(unsafe.Pointer(v.UnsafeAddr()), r.length()), b)
+	return nil
+}
+
+func (r *rawReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	if !v.CanAddr() {
+		return r.fixedReadWriter.writeFixed(b, v)
+	}
+	copy(b, rawBytes(unsafe.Pointer(v.UnsafeAddr()), r.length()))
+	return nil
+}
+
+// rawBytes returns the l bytes of memory starting at ptr.
+func rawBytes(ptr unsafe.Pointer, l int) []byte {
+	return unsafe.Slice((*byte)(ptr), l)
+}
+
+// isRawLayout reports whether the memory layout of struct t is equal to its packed form, so it can be copied directly.
+// This is the case if all of its fields are packed, in order, by raw handlers without any padding in between.
+func isRawLayout(t reflect.Type, fields []structField, size int) bool {
+	if len(fields) != t.NumField() || uintptr(size) != t.Size() {
+		return false
+	}
+
+	var offset uintptr
+	for i, field := range fields {
+		if _, ok := field.handler.(*rawReadWriter); !ok || field.index != i || t.Field(i).Offset != offset {
+			return false
+		}
+		if field.padding(int(offset)) != 0 {
+			// Padding is packed as zeroes, which is not guaranteed for the memory in between fields
+			return false
+		}
+		offset += t.Field(i).Type.Size()
+	}
+
+	return true
+}
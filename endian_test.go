@@ -0,0 +1,113 @@
+package ikea
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestByteOrder(t *testing.T) {
+	type mixed struct {
+		A uint16
+		B int32 `ikea:"le"`
+		C []uint16
+		D float32 `ikea:"be"`
+	}
+
+	value := &mixed{A: 0x0102, B: 0x03040506, C: []uint16{0x0708}, D: 1}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{1, 2, 6, 5, 4, 3, 0, 0, 0, 1, 7, 8, 0x3f, 0x80, 0, 0}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestByteOrder, expected %x, got %x", expected, data)
+	}
+
+	data, err = Marshal(value, ByteOrder(LittleEndian))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected = []byte{2, 1, 6, 5, 4, 3, 1, 0, 0, 0, 8, 7, 0x3f, 0x80, 0, 0}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestByteOrder, expected %x, got %x", expected, data)
+	}
+
+	result := new(mixed)
+	if err := Unmarshal(data, result, ByteOrder(LittleEndian)); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestByteOrder, expected %+v, got %+v", value, result)
+	}
+}
+
+func TestNativeEndian(t *testing.T) {
+	type point struct {
+		X, Y int32
+		Z    float64
+	}
+	type padded struct {
+		A uint8
+		B uint32 // Preceded by 3 bytes of padding in memory
+	}
+	type shapes struct {
+		Points []point
+		Padded []padded
+		Grid   [2][2]uint16
+		Flags  []bool
+	}
+
+	opts := []Option{ByteOrder(NativeEndian)}
+	if h, err := getTypeHandler(reflect.TypeOf(point{}), newOptions(opts).cfg); err != nil {
+		t.Error(err)
+	} else if _, raw := h.(*rawReadWriter); !raw {
+		t.Errorf("Failing TestNativeEndian, expected point to be copied directly, got %T", h)
+	}
+	if h, err := getTypeHandler(reflect.TypeOf(padded{}), newOptions(opts).cfg); err != nil {
+		t.Error(err)
+	} else if _, raw := h.(*rawReadWriter); raw {
+		t.Error("Failing TestNativeEndian, padded can not be copied directly")
+	}
+
+	value := &shapes{
+		Points: []point{{1, 2, 3.5}, {-4, 5, 6}},
+		Padded: []padded{{1, 2}},
+		Grid:   [2][2]uint16{{1, 2}, {3, 4}},
+		Flags:  []bool{true, false},
+	}
+	data, err := Marshal(value, opts...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l, err := Len(value, opts...); err != nil || l != len(data) {
+		t.Errorf("Failing TestNativeEndian, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+	if x := int32(nativeOrder.Uint32(data[4:])); x != 1 {
+		t.Errorf("Failing TestNativeEndian, expected X in native byte order, got %x", data[4:8])
+	}
+
+	result := new(shapes)
+	if err := Unmarshal(data, result, opts...); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestNativeEndian, expected %+v, got %+v", value, result)
+	}
+
+	// Map values are not addressable, so they can't be copied directly
+	m := map[uint8]point{1: {7, 8, 9}}
+	data, err = Marshal(m, opts...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if x := nativeOrder.Uint32(data[5:]); x != 7 {
+		t.Errorf("Failing TestNativeEndian, expected X of the map value to be 7, got %d", x)
+	}
+}
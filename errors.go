@@ -0,0 +1,166 @@
+package ikea
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrOverflow is returned when a value does not fit in the size it is packed as, or unpacked into.
+var ErrOverflow = errors.New("ikea: value out of range")
+
+// UnsupportedTypeError is returned when a type is encountered that can not be packed or unpacked.
+type UnsupportedTypeError struct {
+	Type  reflect.Type
+	Field string // The name of the struct field holding the type, if any
+	Hint  string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	msg := fmt.Sprintf("ikea: unsupported type %s", e.Type)
+	if e.Field != "" {
+		msg += " in field " + e.Field
+	}
+	if e.Hint != "" {
+		msg += ", " + e.Hint
+	}
+	return msg
+}
+
+// NilValueError is returned when a nil value is attempted to be packed.
+type NilValueError struct {
+	Type  reflect.Type
+	Field string // The name of the struct field holding the value, if any
+}
+
+func (e *NilValueError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("ikea: cannot pack nil value of type %s in field %s", e.Type, e.Field)
+	}
+	return fmt.Sprintf("ikea: cannot pack nil value of type %s", e.Type)
+}
+
+// InvalidTagError is returned when the ikea tag of a struct field can not be parsed.
+type InvalidTagError struct {
+	Type  reflect.Type // The struct type holding the field
+	Field string
+	Tag   string
+	Err   error
+}
+
+func (e *InvalidTagError) Error() string {
+	return fmt.Sprintf("ikea: invalid tag %q on field %s.%s: %s", e.Tag, e.Type, e.Field, e.Err.Error())
+}
+
+func (e *InvalidTagError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidUnpackError is returned when a value that is not a non-nil pointer is passed to Unpack.
+type InvalidUnpackError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnpackError) Error() string {
+	if e.Type == nil {
+		return "ikea: Unpack(nil)"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return fmt.Sprintf("ikea: Unpack(non-pointer %s)", e.Type)
+	}
+	return fmt.Sprintf("ikea: Unpack(nil %s)", e.Type)
+}
+
+// FieldError wraps errors that occurred while packing or unpacking a specific field.
+// Path describes the location of the field within the packed value, like "myBlob.C.Items[3].Name".
+// The underlying error is available through errors.Is and errors.As.
+type FieldError struct {
+	Path string
+	Type reflect.Type // The type of the innermost field
+	// Offset is the position in the stream where the innermost field started, or -1 if unknown.
+	// For fields within compressed fields, this is the position within the decompressed data.
+	Offset int64
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	// The wrapped error will often have our prefix too, don't repeat it
+	msg := strings.TrimPrefix(e.Err.Error(), "ikea: ")
+	if e.Offset < 0 {
+		return fmt.Sprintf("ikea: field %s (%s): %s", e.Path, e.Type, msg)
+	}
+	return fmt.Sprintf("ikea: field %s (%s) at offset %d: %s", e.Path, e.Type, e.Offset, msg)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// wrapFieldError prefixes the path of err with name, or wraps err in a new FieldError if it is not one yet.
+func wrapFieldError(err error, name string, typ reflect.Type, offset int64) error {
+	if fe, ok := err.(*FieldError); ok {
+		if strings.HasPrefix(fe.Path, "[") {
+			fe.Path = name + fe.Path
+		} else {
+			fe.Path = name + "." + fe.Path
+		}
+		return fe
+	}
+
+	return &FieldError{Path: name, Type: typ, Offset: offset, Err: err}
+}
+
+// wrapIndexError is wrapFieldError for elements of slices.
+func wrapIndexError(err error, index int, typ reflect.Type, offset int64) error {
+	return wrapFieldError(err, "["+strconv.Itoa(index)+"]", typ, offset)
+}
+
+// offsetFieldError moves the offset of err by delta, used by fixed handlers which only know their relative position.
+func offsetFieldError(err error, delta int64) error {
+	if fe, ok := err.(*FieldError); ok && fe.Offset >= 0 {
+		fe.Offset += delta
+	}
+	return err
+}
+
+// withRoot prefixes the path of a FieldError with the name of the type that was packed or unpacked.
+// Nested calls from custom Packers and Unpackers are left alone, as they are part of a larger path.
+func withRoot(err error, t reflect.Type, calls int) error {
+	fe, ok := err.(*FieldError)
+	if !ok || calls != 0 {
+		return err
+	}
+
+	name := t.Name()
+	if name == "" {
+		name = t.String()
+	}
+	return wrapFieldError(fe, name, t, -1)
+}
+
+// Check will verify that values of type t can be packed and unpacked using opts, without packing anything.
+// This allows validating all types once, rather than running into an error on the first use.
+func Check(t reflect.Type, opts ...Option) error {
+	if t == nil {
+		return &NilValueError{Type: t}
+	}
+	_, err := getTypeHandler(t, newOptions(opts).cfg)
+	return err
+}
+
+// withField fills in the field name on errors that carry one, if it was not set by a deeper level already.
+func withField(err error, field string) error {
+	switch e := err.(type) {
+	case *UnsupportedTypeError:
+		if e.Field == "" {
+			e.Field = field
+		}
+	case *NilValueError:
+		if e.Field == "" {
+			e.Field = field
+		}
+	}
+	return err
+}
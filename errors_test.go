@@ -2,53 +2,80 @@ package ikea
 
 import (
 	"bytes"
+	"compress/flate"
 	"errors"
+	"io"
 	"math"
+	"reflect"
+	"runtime"
 	"testing"
 )
 
 func TestReadPointer(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestReadPointer should have panicked due to an invalid argument, it didn't")
-		}
-	}()
+	var i int32
+	if _, ok := Unpack(nil, i).(*InvalidUnpackError); !ok {
+		t.Error("TestReadPointer should have failed due to an invalid argument, it didn't")
+	}
 
-	var i int
-	_ = Unpack(nil, i)
+	if _, ok := Unpack(nil, (*int32)(nil)).(*InvalidUnpackError); !ok {
+		t.Error("TestReadPointer should have failed due to a nil pointer argument, it didn't")
+	}
 }
 
 func TestUseInt(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestUseInt should have panicked due to an unsupported type, it didn't")
-		}
-	}()
-
 	var i int
-	_ = Unpack(nil, &i)
+	if _, ok := Unpack(nil, &i).(*UnsupportedTypeError); !ok {
+		t.Error("TestUseInt should have failed due to an unsupported type, it didn't")
+	}
 }
 
 func TestUseUint(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestUseUint should have panicked due to an unsupported type, it didn't")
-		}
-	}()
-
 	var ui uint
-	_ = Unpack(nil, &ui) // uint is not supported
+	if _, ok := Unpack(nil, &ui).(*UnsupportedTypeError); !ok { // uint is not supported
+		t.Error("TestUseUint should have failed due to an unsupported type, it didn't")
+	}
 }
 
 func TestUnsupportedType(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestUseUint should have panicked due to an unsupported type, it didn't")
+	var c complex64
+	if _, ok := Unpack(nil, &c).(*UnsupportedTypeError); !ok { // complex64 is not supported
+		t.Error("TestUnsupportedType should have failed due to an unsupported type, it didn't")
+	}
+
+	s := struct {
+		A uint8
+		B chan struct{}
+	}{}
+	err := Pack(new(bytes.Buffer), &s)
+	if e, ok := err.(*UnsupportedTypeError); !ok || e.Field != "B" {
+		t.Errorf("TestUnsupportedType should have failed due to an unsupported type in field B, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check(reflect.TypeOf(testStruct{})); err != nil {
+		t.Errorf("TestCheck should have accepted testStruct, got %v", err)
+	}
+
+	type recursive struct {
+		A []recursive
+		B complex128
+	}
+	for i := 0; i < 2; i++ { // The second attempt is served from the type cache
+		if _, ok := Check(reflect.TypeOf(recursive{})).(*UnsupportedTypeError); !ok {
+			t.Error("TestCheck should have failed due to an unsupported type, it didn't")
+		}
+		if _, ok := Check(reflect.TypeOf([]recursive{})).(*UnsupportedTypeError); !ok {
+			t.Error("TestCheck should have failed due to an unsupported slice element, it didn't")
 		}
-	}()
+	}
 
-	var ui complex64
-	_ = Unpack(nil, &ui) // uint is not supported
+	if _, ok := Check(reflect.TypeOf(nil)).(*NilValueError); !ok {
+		t.Error("TestCheck should have failed due to a nil type, it didn't")
+	}
+	if _, ok := CheckLayout(reflect.TypeOf(nil)).(*NilValueError); !ok {
+		t.Error("TestCheck should have failed due to a nil type in CheckLayout, it didn't")
+	}
 }
 
 func TestVariableLengthOverflow(t *testing.T) {
@@ -94,12 +121,16 @@ func TestCompressionInitError(t *testing.T) {
 	s2 := struct {
 		Data []byte `ikea:"compress:a"`
 	}{make([]byte, 10)}
-	defer func() {
-		if recover() == nil {
-			t.Error("TestCompressionInitError should have failed because of an non-numerical compression level")
-		}
-	}()
-	_ = Pack(new(bytes.Buffer), &s2)
+	if e, ok := Pack(new(bytes.Buffer), &s2).(*InvalidTagError); !ok || e.Field != "Data" {
+		t.Error("TestCompressionInitError should have failed because of an non-numerical compression level")
+	}
+
+	s3 := struct {
+		Data []byte `ikea:"compres"`
+	}{make([]byte, 10)}
+	if _, ok := Pack(new(bytes.Buffer), &s3).(*InvalidTagError); !ok {
+		t.Error("TestCompressionInitError should have failed because of an unknown tag option")
+	}
 }
 
 func TestInvalidUTF8(t *testing.T) {
@@ -111,49 +142,45 @@ func TestInvalidUTF8(t *testing.T) {
 }
 
 func TestFixedNilPointerPacking(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestFixedNilPointerPacking should panic because of an attempt to write an uninitialized variable, it didn't")
-		}
-	}()
-
 	s := struct {
 		A *uint32
 	}{}
-	_ = Pack(new(bytes.Buffer), &s)
+	var e *NilValueError
+	if !errors.As(Pack(new(bytes.Buffer), &s), &e) || e.Field != "A" {
+		t.Error("TestFixedNilPointerPacking should fail because of an attempt to write an uninitialized variable, it didn't")
+	}
 }
 
 func TestVariableNilPointerPacking(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestVariableNilPointerPacking should panic because of an attempt to write an uninitialized variable, it didn't")
-		}
-	}()
-
 	s := struct {
 		A *string
 	}{}
-	_ = Pack(new(bytes.Buffer), &s)
+	var e *NilValueError
+	if !errors.As(Pack(new(bytes.Buffer), &s), &e) || e.Field != "A" {
+		t.Error("TestVariableNilPointerPacking should fail because of an attempt to write an uninitialized variable, it didn't")
+	}
+
+	if _, ok := Pack(new(bytes.Buffer), nil).(*NilValueError); !ok {
+		t.Error("TestVariableNilPointerPacking should fail because of an attempt to write nil, it didn't")
+	}
 }
 
 func TestFixedNilPointerLength(t *testing.T) {
 	s := struct {
 		A *uint32
 	}{}
-	Len(&s) // Unlike all other nil values, this should succeed
+	if _, err := Len(&s); err != nil { // Unlike all other nil values, this should succeed
+		t.Error(err)
+	}
 }
 
 func TestVariableNilPointerLength(t *testing.T) {
-	defer func() {
-		if recover() == nil {
-			t.Error("TestVariableNilPointerLength should panic because of an attempt to write an uninitialized variable, it didn't")
-		}
-	}()
-
 	s := struct {
 		A *string
 	}{}
-	Len(&s)
+	if _, err := Len(&s); err == nil {
+		t.Error("TestVariableNilPointerLength should fail because of an attempt to write an uninitialized variable, it didn't")
+	}
 }
 
 func TestReadErrors(t *testing.T) {
@@ -217,3 +244,199 @@ func (s *errorStream) Reset() {
 	s.pass = s.pointer
 	s.pointer = 0
 }
+
+func TestFieldErrorPath(t *testing.T) {
+	type item struct {
+		Name string
+	}
+	type container struct {
+		Items []item
+	}
+	type blob struct {
+		A uint32
+		C container
+	}
+
+	data, err := Marshal(&blob{A: 1, C: container{Items: []item{{"a"}, {"b"}, {"c"}, {"d"}}}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data[len(data)-1] = 0xF1 // Corrupt the utf8 of the last name
+
+	var fe *FieldError
+	if err := Unmarshal(data, new(blob)); !errors.As(err, &fe) {
+		t.Errorf("TestFieldErrorPath should have returned a FieldError, got %v", err)
+		return
+	}
+	if fe.Path != "blob.C.Items[3].Name" || fe.Type != reflect.TypeOf("") || fe.Offset != int64(len(data)-5) {
+		t.Errorf("TestFieldErrorPath returned incorrect error details: %s", fe.Error())
+	}
+
+	var ptrs struct {
+		A []*uint32
+	}
+	ptrs.A = []*uint32{new(uint32), nil}
+	if err := Pack(new(bytes.Buffer), &ptrs); !errors.As(err, &fe) || fe.Path != "struct { A []*uint32 }.A[1]" || fe.Offset != 8 {
+		t.Errorf("TestFieldErrorPath returned incorrect error details: %v", err)
+	}
+
+	if err := Unmarshal(data[:10], new(blob)); !errors.Is(err, io.ErrUnexpectedEOF) || !errors.As(err, &fe) || fe.Path != "blob.C.Items[0].Name" {
+		t.Errorf("TestFieldErrorPath should have returned an unexpected EOF, got %v", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	data, err := Marshal(source)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	limits := []struct {
+		option Option
+		err    error
+	}{
+		{MaxSliceLength(10), ErrSliceTooLong},
+		{MaxStringLength(10), ErrStringTooLong},
+		{MaxMapEntries(1), ErrMapTooLarge},
+		{MaxBytes(100), ErrMessageTooLarge},
+		{MaxDepth(2), ErrTooDeep},
+	}
+	for _, limit := range limits {
+		if err := Unmarshal(data, new(testStruct), limit.option); !errors.Is(err, limit.err) {
+			t.Errorf("TestDecodeLimits should have failed with \"%v\", got %v", limit.err, err)
+		}
+	}
+
+	if err := Unmarshal(data, new(testStruct), MaxSliceLength(10000), MaxStringLength(100), MaxMapEntries(2),
+		MaxBytes(int64(len(data))), MaxDepth(5)); err != nil {
+		t.Errorf("TestDecodeLimits should have accepted data within limits, got %v", err)
+	}
+
+	nested, err := Marshal([1][1][1]string{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := Unmarshal(nested, new([1][1][1]string), MaxDepth(2)); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("TestDecodeLimits should have failed with \"%v\" for nested arrays, got %v", ErrTooDeep, err)
+	}
+	if err := Unmarshal(nested, new([1][1][1]string), MaxDepth(3)); err != nil {
+		t.Errorf("TestDecodeLimits should have accepted nested arrays within the depth limit, got %v", err)
+	}
+
+	// A corrupt length prefix should be rejected before anything is allocated
+	corrupt := []byte{0x7F, 0xFF, 0xFF, 0xFF}
+	var s []uint64
+	if err := Unmarshal(corrupt, &s, MaxBytes(1024)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("TestDecodeLimits should have failed with \"%v\", got %v", ErrMessageTooLarge, err)
+	}
+
+	// Variable sized elements are read one by one, so their allocation is bounded by the bytes left instead
+	var strs []string
+	var m map[string]string
+	if allocated := allocatedBytes(func() {
+		if err := Unmarshal(corrupt, &strs, MaxBytes(64)); err == nil {
+			t.Error("TestDecodeLimits should have rejected a corrupt []string")
+		}
+		if err := Unmarshal(corrupt, &m, MaxBytes(64)); err == nil {
+			t.Error("TestDecodeLimits should have rejected a corrupt map[string]string")
+		}
+	}); allocated > 1<<20 {
+		t.Errorf("TestDecodeLimits allocated %d bytes for a corrupt prefix", allocated)
+	}
+}
+
+// allocatedBytes returns the amount of bytes allocated while running f.
+func allocatedBytes(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestDecompressionLimits(t *testing.T) {
+	type bomb struct {
+		Data []byte `ikea:"compress:9"`
+	}
+	type limitedBomb struct {
+		Data []byte `ikea:"compress:9,maxout:1000"`
+	}
+
+	data, err := Marshal(&bomb{Data: make([]byte, 100000)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := Unmarshal(data, new(bomb), MaxDecompressedSize(10000)); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("TestDecompressionLimits should have failed with \"%v\", got %v", ErrDecompressedTooLarge, err)
+	}
+	if err := Unmarshal(data, new(limitedBomb)); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("TestDecompressionLimits should have failed with \"%v\" due to the maxout tag, got %v", ErrDecompressedTooLarge, err)
+	}
+	if err := Unmarshal(data, new(bomb), MaxCompressionRatio(10)); !errors.Is(err, ErrCompressionRatio) {
+		t.Errorf("TestDecompressionLimits should have failed with \"%v\", got %v", ErrCompressionRatio, err)
+	}
+	if err := Unmarshal(data, new(bomb), MaxDecompressedSize(100004), MaxCompressionRatio(1000)); err != nil {
+		t.Errorf("TestDecompressionLimits should have accepted data within limits, got %v", err)
+	}
+
+	// A tiny inflated payload can still declare millions of variable sized elements
+	var buf bytes.Buffer
+	z, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = z.Write([]byte{0x02, 0xFA, 0xF0, 0x80})
+	_ = z.Close()
+	prefixed := append([]byte{0, 0, 0, byte(buf.Len())}, buf.Bytes()...)
+	var list struct {
+		Data []string `ikea:"compress:9"`
+	}
+	if allocated := allocatedBytes(func() {
+		if err := Unmarshal(prefixed, &list, MaxDecompressedSize(1024), MaxCompressionRatio(10)); err == nil {
+			t.Error("TestDecompressionLimits should have rejected a corrupt compressed []string")
+		}
+	}); allocated > 1<<20 {
+		t.Errorf("TestDecompressionLimits allocated %d bytes for a corrupt compressed []string", allocated)
+	}
+
+	// Without the decompression limits, the inflated stream is unbounded, but allocations still follow its bytes
+	for _, payload := range [][]byte{
+		{0x10, 0, 0, 0},             // []string
+		{0x10, 0, 0, 0, 0xFF, 0xFF}, // []uint64
+		{0x7F, 0xFF, 0xFF, 0xF0, 1}, // string
+	} {
+		buf.Reset()
+		z.Reset(&buf)
+		_, _ = z.Write(payload)
+		_ = z.Close()
+		prefixed = append([]byte{0, 0, 0, byte(buf.Len())}, buf.Bytes()...)
+
+		if allocated := allocatedBytes(func() {
+			var unlimited struct {
+				Strings []string `ikea:"compress"`
+			}
+			var numbers struct {
+				Numbers []uint64 `ikea:"compress"`
+			}
+			var text struct {
+				Text string `ikea:"compress"`
+			}
+			for _, v := range []interface{}{&unlimited, &numbers, &text} {
+				if err := Unmarshal(prefixed, v, MaxBytes(1024)); err == nil {
+					t.Errorf("TestDecompressionLimits should have rejected %x as %T", payload, v)
+				}
+			}
+		}); allocated > 4<<20 {
+			t.Errorf("TestDecompressionLimits allocated %d bytes for corrupt payload %x", allocated, payload)
+		}
+	}
+
+	var invalid struct {
+		Data []byte `ikea:"maxout:1000"`
+	}
+	if _, ok := Check(reflect.TypeOf(invalid)).(*InvalidTagError); !ok {
+		t.Error("TestDecompressionLimits should have rejected maxout on an uncompressed field")
+	}
+}
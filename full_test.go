@@ -3,7 +3,9 @@ package ikea
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -97,7 +99,9 @@ func TestCompleteRead(t *testing.T) {
 }
 
 func TestLen(t *testing.T) {
-	if l := Len(source); l != len(testData) {
+	if l, err := Len(source); err != nil {
+		t.Error(err)
+	} else if l != len(testData) {
 		t.Errorf("Failing TestLen, Len reported an incorrect value %d, should be %d", l, len(testData))
 	}
 }
@@ -125,3 +129,127 @@ type testUnpackerOnly struct {
 func (p *testUnpackerOnly) Unpack(r io.Reader) error {
 	return Unpack(r, &p.A)
 }
+
+func TestMarshal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := Pack(buf, source); err != nil {
+		t.Error(err)
+		return
+	}
+
+	result, err := Marshal(source)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(result) != cap(result) {
+		t.Errorf("Failing TestMarshal, result length (%d) does not match its capacity (%d)", len(result), cap(result))
+	}
+
+	// The map is still iterated in random order, so we only compare everything before it
+	resultParts := strings.Split(hex.EncodeToString(result), "4242")
+	packParts := strings.Split(hex.EncodeToString(buf.Bytes()), "4242")
+	if len(result) != buf.Len() || resultParts[0] != packParts[0] {
+		t.Errorf("Failing TestMarshal, hex output \"%s\" does not match Pack output", hex.EncodeToString(result))
+	}
+
+	prefix := []byte{0xDE, 0xAD}
+	appended, err := AppendPack(prefix, uint16(0xBEEF))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(appended, []byte{0xDE, 0xAD, 0xBE, 0xEF}) {
+		t.Errorf("Failing TestMarshal, AppendPack output \"%s\" is incorrect", hex.EncodeToString(appended))
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data, err := Marshal(source)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tst := new(testStruct)
+	if err := Unmarshal(data, tst); err != nil {
+		t.Error(err)
+		return
+	}
+	compare(t, "TestString", tst.TestString, source.TestString)
+	compare(t, "TestSubStruct", tst.TestSubStruct.A, source.TestSubStruct.A)
+
+	if err := Unmarshal(append(data, 0x00), tst); err != ErrTrailingData {
+		t.Errorf("Failing TestUnmarshal, trailing data should have resulted in ErrTrailingData, got %v", err)
+	}
+}
+
+func TestSortedMap(t *testing.T) {
+	m := map[int16]string{3: "c", -1: "a", 2: "b", 100: "d"}
+	data, err := Marshal(m, SortMapKeys())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected, _ := hex.DecodeString("00000004" + "ffff0000000161" + "00020000000162" + "00030000000163" + "00640000000164")
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestSortedMap, hex output \"%s\" is not sorted", hex.EncodeToString(data))
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		S []string `ikea:"sorted"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestSortedMap, expected sorted on a slice to be rejected, got %v", err)
+	}
+
+	type sortedField struct {
+		M map[[2]uint8]map[string]bool `ikea:"sorted"`
+	}
+	s := sortedField{M: map[[2]uint8]map[string]bool{
+		{2, 1}: {"z": true, "y": false, "x": true},
+		{1, 2}: {"b": true, "a": false},
+		{1, 1}: nil,
+	}}
+	first, err := Marshal(&s)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 10; i++ {
+		again, err := Marshal(&s)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(first, again) {
+			t.Errorf("Failing TestSortedMap, hex output \"%s\" differs from \"%s\"", hex.EncodeToString(again), hex.EncodeToString(first))
+			return
+		}
+	}
+
+	// NaN keys are all distinct, but can't be ordered by their key alone
+	nans := map[float64]uint8{math.NaN(): 1, math.NaN(): 2, math.NaN(): 3, 0: 4}
+	nanData, err := Marshal(nans, SortMapKeys())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 20; i++ {
+		if again, err := Marshal(nans, SortMapKeys()); err != nil || !bytes.Equal(nanData, again) {
+			t.Errorf("Failing TestSortedMap, NaN keys resulted in \"%s\" and \"%s\" (%v)", hex.EncodeToString(nanData), hex.EncodeToString(again), err)
+			return
+		}
+	}
+
+	result := new(sortedField)
+	if err := Unmarshal(first, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result.M[[2]uint8{2, 1}], s.M[[2]uint8{2, 1}]) {
+		t.Errorf("Failing TestSortedMap, resulting map is not equal")
+	}
+}
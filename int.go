@@ -0,0 +1,175 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// wireHandlers holds the integer types that values can be packed as using the wire tag.
+var wireHandlers = map[reflect.Kind]*intReadWriter{
+	reflect.Int8: {size: 1, signed: true}, reflect.Int16: {size: 2, signed: true},
+	reflect.Int32: {size: 4, signed: true}, reflect.Int64: {size: 8, signed: true},
+	reflect.Uint8: {size: 1}, reflect.Uint16: {size: 2}, reflect.Uint32: {size: 4}, reflect.Uint64: {size: 8},
+}
+
+// parseWireKind returns the kind named by s, if integers can be packed as it.
+func parseWireKind(s string) (reflect.Kind, error) {
+	for kind := range wireHandlers {
+		if kind.String() == s {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown wire type %q", s)
+}
+
+func getWireHandler(cfg config) readWriter {
+	h := *wireHandlers[cfg.wire]
+	h.order = cfg.order.byteOrder()
+	return &h
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func getIntHandlerFromType(typ reflect.Type, cfg config) (readWriter, error) {
+	if cfg.varint {
+		return varintHandler, nil
+	}
+	if cfg.wire != 0 {
+		return getWireHandler(cfg), nil
+	}
+
+	switch cfg.intSize {
+	case 32, 64:
+		return &intReadWriter{size: cfg.intSize / 8, signed: typ.Kind() == reflect.Int, order: cfg.order.byteOrder()}, nil
+	case 0:
+		return nil, &UnsupportedTypeError{Type: typ, Hint: "types uint and int are not supported by default, as their " +
+			"actual size is dependant on compiler architecture and could cause data inconsistencies. use " +
+			"uint32/uint64/int32/int64 instead, or pick a size using a tag like `ikea:\"int64\"` or the IntSize option"}
+	default:
+		return nil, &UnsupportedTypeError{Type: typ, Hint: fmt.Sprintf("invalid int size %d, use 32 or 64", cfg.intSize)}
+	}
+}
+
+var _ fixedReadWriter = (*intReadWriter)(nil)
+
+// intReadWriter packs integers using an explicit size and signedness, which may differ from those of the Go type.
+// Values are sign or zero extended when unpacking, values that don't fit either way result in ErrOverflow.
+type intReadWriter struct {
+	fixed
+	size   int
+	signed bool
+	order  binary.ByteOrder
+}
+
+func (i *intReadWriter) length() int {
+	return i.size
+}
+
+func (i *intReadWriter) String() string {
+	if i.signed {
+		return fmt.Sprintf("int%d", i.size*8)
+	}
+	return fmt.Sprintf("uint%d", i.size*8)
+}
+
+// bounds returns the range of values that can be packed.
+func (i *intReadWriter) bounds() (min int64, max uint64) {
+	bits := uint(i.size * 8)
+	if i.signed {
+		return -1 << (bits - 1), 1<<(bits-1) - 1
+	}
+	return 0, math.MaxUint64 >> (64 - bits)
+}
+
+func (i *intReadWriter) readFixed(b []byte, v reflect.Value) error {
+	var raw uint64
+	switch i.size {
+	case 1:
+		raw = uint64(b[0])
+	case 2:
+		raw = uint64(i.order.Uint16(b))
+	case 4:
+		raw = uint64(i.order.Uint32(b))
+	default:
+		raw = i.order.Uint64(b)
+	}
+
+	if i.signed {
+		shift := uint(64 - i.size*8)
+		n := int64(raw<<shift) >> shift // Sign extend
+		if isSigned(v.Kind()) {
+			if v.OverflowInt(n) {
+				return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, n, v.Type())
+			}
+			v.SetInt(n)
+			return nil
+		}
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, n, v.Type())
+		}
+		v.SetUint(uint64(n))
+		return nil
+	}
+
+	if isSigned(v.Kind()) {
+		if raw > math.MaxInt64 || v.OverflowInt(int64(raw)) {
+			return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, raw, v.Type())
+		}
+		v.SetInt(int64(raw))
+		return nil
+	}
+	if v.OverflowUint(raw) {
+		return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, raw, v.Type())
+	}
+	v.SetUint(raw)
+	return nil
+}
+
+func (i *intReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	min, max := i.bounds()
+
+	var raw uint64
+	if isSigned(v.Kind()) {
+		n := v.Int()
+		if n < min || (n > 0 && uint64(n) > max) {
+			return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, n, i)
+		}
+		raw = uint64(n)
+	} else {
+		raw = v.Uint()
+		if raw > max {
+			return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, raw, i)
+		}
+	}
+
+	switch i.size {
+	case 1:
+		b[0] = byte(raw)
+	case 2:
+		i.order.PutUint16(b, uint16(raw))
+	case 4:
+		i.order.PutUint32(b, uint32(raw))
+	default:
+		i.order.PutUint64(b, raw)
+	}
+	return nil
+}
+
+func isSigned(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,133 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestIntSize(t *testing.T) {
+	type ints struct {
+		A int `ikea:"int32"`
+		B uint
+		C []int `ikea:"int32"`
+	}
+
+	value := &ints{A: -2, B: 3, C: []int{4}}
+	if _, err := Marshal(value); err == nil {
+		t.Error("Failing TestIntSize, B should not be supported without a size")
+	}
+
+	data, err := Marshal(value, IntSize(64))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{0xff, 0xff, 0xff, 0xfe, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 4}) {
+		t.Errorf("Failing TestIntSize, unexpected output %x", data)
+	}
+
+	result := new(ints)
+	if err := Unmarshal(data, result, IntSize(64)); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.A != -2 || result.B != 3 || len(result.C) != 1 || result.C[0] != 4 {
+		t.Errorf("Failing TestIntSize, unexpected result %+v", result)
+	}
+
+	if _, err := Marshal(&ints{A: math.MaxInt32 + 1}, IntSize(64)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Failing TestIntSize, expected an overflow of A, got %v", err)
+	}
+
+	var u uint
+	if err := Unmarshal([]byte{0x80, 0, 0, 0, 0, 0, 0, 0}, &u, IntSize(64)); err != nil || u != 1<<63 {
+		t.Errorf("Failing TestIntSize, expected %d, got %d (%v)", uint64(1<<63), u, err)
+	}
+
+	var fe *FieldError
+	if _, err := Marshal(&ints{C: []int{1, -1 << 40}}, IntSize(64)); !errors.Is(err, ErrOverflow) ||
+		!errors.As(err, &fe) || fe.Path != "ints.C[1]" || fe.Offset != 20 {
+		t.Errorf("Failing TestIntSize, expected an overflow of C[1] at offset 20, got %v", err)
+	}
+
+	var e *UnsupportedTypeError
+	if err := Check(reflect.TypeOf(ints{}), IntSize(16)); !errors.As(err, &e) {
+		t.Errorf("Failing TestIntSize, expected IntSize(16) to be rejected, got %v", err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		A int16 `ikea:"int64"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestIntSize, expected int64 on an int16 to be rejected, got %v", err)
+	}
+}
+
+func TestWireSize(t *testing.T) {
+	type telemetry struct {
+		Temperature int64    `ikea:"wire:int8"`
+		Altitude    *uint64  `ikea:"wire:uint16"`
+		Samples     []int32  `ikea:"wire:int16"`
+		Count       int      `ikea:"wire:uint8"`
+		Offsets     [2]int16 `ikea:"wire:uint32"`
+	}
+
+	altitude := uint64(4000)
+	value := &telemetry{Temperature: -40, Altitude: &altitude, Samples: []int32{-300, 300}, Count: 200, Offsets: [2]int16{1, 2}}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{0xd8, 0x0f, 0xa0, 0, 0, 0, 2, 0xfe, 0xd4, 0x01, 0x2c, 200, 0, 0, 0, 1, 0, 0, 0, 2}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestWireSize, expected %x, got %x", expected, data)
+	}
+
+	result := new(telemetry)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Temperature != -40 || *result.Altitude != 4000 || len(result.Samples) != 2 || result.Samples[0] != -300 ||
+		result.Count != 200 || result.Offsets != value.Offsets {
+		t.Errorf("Failing TestWireSize, unexpected result %+v", result)
+	}
+
+	// Fixed structs remain fixed
+	type fixedTelemetry struct {
+		A int64  `ikea:"wire:uint8"`
+		B uint32 `ikea:"wire:int16"`
+	}
+	h, err := getTypeHandler(reflect.TypeOf(fixedTelemetry{}), config{})
+	if err != nil || !h.isFixed() || h.(fixedReadWriter).length() != 3 {
+		t.Errorf("Failing TestWireSize, expected a fixed handler of 3 bytes, got %v (%v)", h, err)
+	}
+
+	var fe *FieldError
+	if _, err := Marshal(&fixedTelemetry{A: -1}); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Path != "fixedTelemetry.A" {
+		t.Errorf("Failing TestWireSize, expected a negative A to overflow, got %v", err)
+	}
+	if _, err := Marshal(&fixedTelemetry{B: 40000}); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Offset != 1 {
+		t.Errorf("Failing TestWireSize, expected B to overflow at offset 1, got %v", err)
+	}
+	if err := Unmarshal([]byte{1, 0xff, 0xff}, new(fixedTelemetry)); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) ||
+		fe.Path != "fixedTelemetry.B" || fe.Offset != 1 {
+		t.Errorf("Failing TestWireSize, expected -1 to overflow B at offset 1, got %v", err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		A string `ikea:"wire:uint8"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestWireSize, expected wire on a string to be rejected, got %v", err)
+	}
+	if err := Check(reflect.TypeOf(struct {
+		A int64 `ikea:"wire:uint24"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestWireSize, expected an unknown wire type to be rejected, got %v", err)
+	}
+}
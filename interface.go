@@ -26,19 +26,27 @@ var _ variableReadWriter = (*customReadWriter)(nil)
 type customReadWriter struct {
 	variable
 	fallback readWriter
+	opts     *options // Used by vLength, so calls to Pack from within a Packer use the same config
 }
 
-func (c *customReadWriter) readVariable(r io.Reader, v reflect.Value) error {
+func (c *customReadWriter) readVariable(r *reader, v reflect.Value) error {
+	target := addressable(v)
+
 	var err error
-	if d, ok := v.Addr().Interface().(Unpacker); ok {
+	if d, ok := target.Addr().Interface().(Unpacker); ok {
 		err = d.Unpack(r)
 	} else {
-		err = handleVariableReader(r, c.fallback, v)
+		err = handleVariableReader(r, c.fallback, target)
+	}
+	if err == nil && !v.CanAddr() {
+		v.Set(target)
 	}
 	return err
 }
 
-func (c *customReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
+func (c *customReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	v = addressable(v)
+
 	var err error
 	if s, ok := v.Addr().Interface().(Packer); ok {
 		err = s.Pack(w)
@@ -48,8 +56,20 @@ func (c *customReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
 	return err
 }
 
-func (c *customReadWriter) vLength(v reflect.Value) int {
+// addressable returns v if it is addressable, or an addressable copy of it otherwise, as Packers and Unpackers are
+// usually implemented on pointers. This is the case for values held by maps and interfaces.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+func (c *customReadWriter) vLength(v reflect.Value) (int, error) {
 	var b bytes.Buffer
-	_ = c.writeVariable(&b, v)
-	return b.Len()
+	err := c.writeVariable(&writer{w: &b, opts: c.opts}, v)
+	return b.Len(), err
 }
@@ -0,0 +1,151 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// lengthSize selects how length prefixes are packed.
+type lengthSize uint8
+
+const (
+	lengthDefault lengthSize = iota // uint32, unless changed using an option
+	lengthUint8
+	lengthUint16
+	lengthUint32
+	lengthUint64
+	lengthVarint
+	lengthInvalid // An unsupported size was passed to LengthSize, which is reported when a handler is looked up
+)
+
+func parseLengthSize(s string) (lengthSize, error) {
+	switch s {
+	case "uint8":
+		return lengthUint8, nil
+	case "uint16":
+		return lengthUint16, nil
+	case "uint32":
+		return lengthUint32, nil
+	case "uint64":
+		return lengthUint64, nil
+	case "varint":
+		return lengthVarint, nil
+	default:
+		return 0, fmt.Errorf("unknown length size %q", s)
+	}
+}
+
+// lengthPrefix describes how the lengths of slices, strings, maps and blobs are packed.
+type lengthPrefix struct {
+	size  lengthSize
+	order binary.ByteOrder
+}
+
+// width returns the amount of bytes of fixed size prefixes, and the largest length they can hold.
+// No prefix holds lengths beyond math.MaxInt32, as those can't be unpacked.
+func (p lengthPrefix) width() (int, uint64) {
+	switch p.size {
+	case lengthUint8:
+		return 1, math.MaxUint8
+	case lengthUint16:
+		return 2, math.MaxUint16
+	case lengthUint64:
+		return 8, math.MaxInt32
+	case lengthVarint:
+		return 0, math.MaxInt32
+	default:
+		return 4, math.MaxInt32
+	}
+}
+
+func (p lengthPrefix) String() string {
+	switch p.size {
+	case lengthUint8:
+		return "uint8"
+	case lengthUint16:
+		return "uint16"
+	case lengthUint64:
+		return "uint64"
+	case lengthVarint:
+		return "varint"
+	default:
+		return "uint32"
+	}
+}
+
+// bytes returns the amount of bytes used to pack the length l, or ErrOverflow if it does not fit.
+func (p lengthPrefix) bytes(l int) (int, error) {
+	width, max := p.width()
+	if uint64(l) > max {
+		return 0, fmt.Errorf("%w: length %d does not fit in a %s prefix", ErrOverflow, l, p)
+	}
+	if p.size == lengthVarint {
+		return uvarintSize(uint64(l)), nil
+	}
+	return width, nil
+}
+
+// readLength reads a length prefix, what is used to describe the length in the error message.
+// If max is above 0 and the length exceeds it, limitErr is returned.
+func (r *reader) readLength(p lengthPrefix, what string, max int, limitErr error) (int, error) {
+	width, allowed := p.width()
+	var ul uint64
+	if p.size == lengthVarint {
+		var err error
+		if ul, err = binary.ReadUvarint(r); err != nil {
+			return 0, err
+		}
+	} else {
+		b, err := r.next(width)
+		if err != nil {
+			return 0, err
+		}
+
+		switch width {
+		case 1:
+			ul = uint64(b[0])
+		case 2:
+			ul = uint64(p.order.Uint16(b))
+		case 8:
+			ul = p.order.Uint64(b)
+		default:
+			ul = uint64(p.order.Uint32(b))
+		}
+	}
+
+	if ul > allowed {
+		return 0, fmt.Errorf("transmitted %s too large (%d>%d)", what, ul, allowed)
+	}
+	if max > 0 && int(ul) > max {
+		return 0, fmt.Errorf("%w (%d>%d)", limitErr, ul, max)
+	}
+
+	return int(ul), nil
+}
+
+// writeLength writes a length prefix, or returns ErrOverflow if l does not fit in it.
+func (w *writer) writeLength(p lengthPrefix, l int) error {
+	width, err := p.bytes(l)
+	if err != nil {
+		return err
+	}
+	if p.size == lengthVarint {
+		return w.writeUvarint(uint64(l))
+	}
+
+	b := w.scratch(width)
+	switch width {
+	case 1:
+		b[0] = byte(l)
+	case 2:
+		p.order.PutUint16(b, uint16(l))
+	case 8:
+		p.order.PutUint64(b, uint64(l))
+	default:
+		p.order.PutUint32(b, uint32(l))
+	}
+
+	_, err = w.Write(b)
+	return err
+}
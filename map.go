@@ -1,35 +1,61 @@
 package ikea
 
 import (
-	"encoding/binary"
+	"bytes"
 	"fmt"
-	"io"
 	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"sync"
 )
 
 var mapIndex = sync.Map{}
 
-func getMapHandlerFromType(t reflect.Type) readWriter {
-	infoV, found := mapIndex.Load(t.String())
+func getMapHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	key := handlerKey{t, cfg}
+	infoV, found := mapIndex.Load(key)
 	if found {
-		return infoV.(readWriter)
+		return infoV.(readWriter), nil
 	}
 
-	t.Key()
-	info := &mapReadWriter{
-		mapType: t,
+	keyHandler, err := getTypeHandler(t.Key(), cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+	valueHandler, err := getTypeHandler(t.Elem(), cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectRest(t, keyHandler); err != nil {
+		return nil, err
+	}
+	if err := rejectRest(t, valueHandler); err != nil {
+		return nil, err
+	}
+
+	policy := cfg.nilPolicy(t)
+	var info readWriter = &mapReadWriter{
+		mapType:   t,
+		rejectNil: policy == NilError,
+		sorted:    cfg.sortMaps,
+		prefix:    cfg.prefix(),
 
 		keyType:    t.Key(),
-		keyHandler: getTypeHandler(t.Key()),
+		keyHandler: keyHandler,
 
 		valueType:    t.Elem(),
-		valueHandler: getTypeHandler(t.Elem()),
+		valueHandler: valueHandler,
+	}
+	if policy == NilPresence {
+		info = &presenceReadWriter{typ: t, handler: info, size: cfg.presenceSize()}
+	}
+
+	if !isPlaceholder(keyHandler) && !isPlaceholder(valueHandler) {
+		mapIndex.Store(key, info)
 	}
-	mapIndex.Store(t.String(), info)
 
-	return info
+	return info, nil
 }
 
 var _ variableReadWriter = (*mapReadWriter)(nil)
@@ -38,33 +64,37 @@ type mapReadWriter struct {
 	variable
 
 	mapType                  reflect.Type
+	rejectNil                bool
+	sorted                   bool
+	prefix                   lengthPrefix
 	keyType, valueType       reflect.Type
 	keyHandler, valueHandler readWriter
 }
 
-func (s *mapReadWriter) readVariable(r io.Reader, v reflect.Value) error {
-	b := make([]byte, 4)
-	if _, err := io.ReadFull(r, b); err != nil {
+func (s *mapReadWriter) readVariable(r *reader, v reflect.Value) error {
+	l, err := r.readLength(s.prefix, "map size", r.opts.maxMapEntries, ErrMapTooLarge)
+	if err != nil {
 		return err
 	}
 
-	ul := binary.BigEndian.Uint32(b)
-	if ul > math.MaxInt32 {
-		return fmt.Errorf("transmitted map size too large (%d>%d)", ul, math.MaxInt32)
+	if err = r.enter(); err != nil {
+		return err
 	}
-	l := int(ul)
+	defer r.leave()
 
-	mp := reflect.MakeMapWithSize(s.mapType, l)
+	mp := reflect.MakeMapWithSize(s.mapType, r.capacity(l))
 
 	for i := 0; i < l; i++ {
 		key := reflect.Indirect(reflect.New(s.keyType))
 		val := reflect.Indirect(reflect.New(s.valueType))
 
+		start := r.n
 		if err := handleVariableReader(r, s.keyHandler, key); err != nil {
-			return err
+			return wrapFieldError(err, "[key "+strconv.Itoa(i)+"]", s.keyType, start)
 		}
+		start = r.n
 		if err := handleVariableReader(r, s.valueHandler, val); err != nil {
-			return err
+			return wrapFieldError(err, mapKeyPath(key), s.valueType, start)
 		}
 
 		mp.SetMapIndex(key, val)
@@ -74,20 +104,103 @@ func (s *mapReadWriter) readVariable(r io.Reader, v reflect.Value) error {
 	return nil
 }
 
-func (s *mapReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(v.Len()))
+func (s *mapReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if s.rejectNil && v.IsNil() {
+		return &NilValueError{Type: s.mapType}
+	}
 
-	if _, err := w.Write(b); err != nil {
+	if err := w.writeLength(s.prefix, v.Len()); err != nil {
 		return err
 	}
 
+	if s.sorted {
+		return s.writeSorted(w, v)
+	}
+
 	it := v.MapRange()
 	for it.Next() {
-		if err := handleVariableWriter(w, s.keyHandler, it.Key()); err != nil {
+		if err := s.writeEntry(w, it.Key(), it.Value(), nil); err != nil {
 			return err
 		}
-		if err := handleVariableWriter(w, s.valueHandler, it.Value()); err != nil {
+	}
+
+	return nil
+}
+
+// writeEntry writes a single key and value, if the key was already packed by writeSorted, it is passed in encoded.
+func (s *mapReadWriter) writeEntry(w *writer, key, value reflect.Value, encoded []byte) error {
+	start := w.n
+	if encoded != nil {
+		if _, err := w.Write(encoded); err != nil {
+			return wrapFieldError(err, mapKeyPath(key), s.keyType, start)
+		}
+	} else if err := handleVariableWriter(w, s.keyHandler, key); err != nil {
+		return wrapFieldError(err, mapKeyPath(key), s.keyType, start)
+	}
+
+	start = w.n
+	if err := handleVariableWriter(w, s.valueHandler, value); err != nil {
+		return wrapFieldError(err, mapKeyPath(key), s.valueType, start)
+	}
+
+	return nil
+}
+
+type mapEntry struct {
+	key, value reflect.Value
+	encoded    []byte // The packed key
+	packed     []byte // The packed key and value, only set for entries of which the keys tie
+}
+
+// writeSorted writes the entries of v ordered by their keys, primitive keys are ordered naturally and all others are
+// ordered by their packed bytes. Keys that tie, like NaNs, are ordered by their packed key and value.
+func (s *mapReadWriter) writeSorted(w *writer, v reflect.Value) error {
+	entries := make([]mapEntry, 0, v.Len())
+	it := v.MapRange()
+	for it.Next() {
+		entries = append(entries, mapEntry{key: it.Key(), value: it.Value()})
+	}
+
+	natural := naturallyOrdered(s.keyType.Kind())
+	if !natural {
+		for i := range entries {
+			var b bytes.Buffer
+			if err := handleVariableWriter(w.child(&b), s.keyHandler, entries[i].key); err != nil {
+				return wrapFieldError(err, mapKeyPath(entries[i].key), s.keyType, -1)
+			}
+			entries[i].encoded = b.Bytes()
+		}
+	}
+
+	var packErr error
+	packed := func(e *mapEntry) []byte {
+		if e.packed == nil && packErr == nil {
+			var b bytes.Buffer
+			packErr = s.writeEntry(w.child(&b), e.key, e.value, e.encoded)
+			e.packed = b.Bytes()
+		}
+		return e.packed
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if natural {
+			if lessValue(a.key, b.key) {
+				return true
+			}
+			if lessValue(b.key, a.key) {
+				return false
+			}
+		} else if c := bytes.Compare(a.encoded, b.encoded); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(packed(a), packed(b)) < 0
+	})
+	if packErr != nil {
+		return packErr
+	}
+
+	for _, entry := range entries {
+		if err := s.writeEntry(w, entry.key, entry.value, entry.encoded); err != nil {
 			return err
 		}
 	}
@@ -95,19 +208,70 @@ func (s *mapReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
 	return nil
 }
 
-func (s *mapReadWriter) vLength(v reflect.Value) int {
-	size := 4
+func naturallyOrdered(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// lessValue compares two values of a kind for which naturallyOrdered returns true.
+func lessValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Float32, reflect.Float64:
+		fa, fb := a.Float(), b.Float()
+		return fa < fb || (math.IsNaN(fa) && !math.IsNaN(fb))
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	default:
+		return a.Uint() < b.Uint()
+	}
+}
+
+func (s *mapReadWriter) vLength(v reflect.Value) (int, error) {
+	if s.rejectNil && v.IsNil() {
+		return 0, &NilValueError{Type: s.mapType}
+	}
+
+	size, err := s.prefix.bytes(v.Len())
+	if err != nil {
+		return 0, err
+	}
 
 	for _, key := range v.MapKeys() {
 		val := v.MapIndex(key)
 
-		l := handleVariableLength(s.keyHandler, key)
+		l, err := handleVariableLength(s.keyHandler, key)
+		if err != nil {
+			return 0, wrapFieldError(err, mapKeyPath(key), s.keyType, -1)
+		}
 		size += l
 
-		l = handleVariableLength(s.valueHandler, val)
-
+		l, err = handleVariableLength(s.valueHandler, val)
+		if err != nil {
+			return 0, wrapFieldError(err, mapKeyPath(key), s.valueType, -1)
+		}
 		size += l
 	}
 
-	return size
+	return size, nil
+}
+
+// mapKeyPath formats a map key for use in a FieldError path.
+func mapKeyPath(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return "[" + strconv.Quote(key.String()) + "]"
+	}
+	if key.CanInterface() {
+		return fmt.Sprintf("[%v]", key.Interface())
+	}
+	return "[" + key.Type().String() + "]"
 }
@@ -0,0 +1,136 @@
+package ikea
+
+import (
+	"encoding"
+	"reflect"
+)
+
+var (
+	binaryMarshalerInterface   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerInterface = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textMarshalerInterface     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerInterface   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// getMarshalerHandler returns a handler for named types implementing both encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler, or their text counterparts if enabled by cfg. It returns nil for any other type.
+// Types implementing Packer or Unpacker are left to getStructHandlerFromType, as those take precedence.
+func getMarshalerHandler(typ reflect.Type, cfg config) readWriter {
+	if typ.PkgPath() == "" || typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Interface {
+		return nil // Unnamed or builtin types, pointers and interfaces are packed by their own handlers
+	}
+
+	ptr := reflect.PtrTo(typ)
+	if ptr.Implements(packerInterface) || ptr.Implements(unpackerInterface) {
+		return nil
+	}
+
+	if implementsOwn(typ, binaryMarshalerInterface, binaryUnmarshalerInterface) {
+		return &marshalerReadWriter{typ: typ, prefix: cfg.prefix()}
+	}
+	if cfg.textMarshalers && implementsOwn(typ, textMarshalerInterface, textUnmarshalerInterface) {
+		return &marshalerReadWriter{typ: typ, text: true, prefix: cfg.prefix()}
+	}
+
+	return nil
+}
+
+// implementsOwn reports whether a pointer to typ implements both interfaces, through methods that are not promoted from
+// an embedded field. Otherwise, a struct embedding a time.Time would be packed as just that time, losing its other fields.
+func implementsOwn(typ reflect.Type, marshaler, unmarshaler reflect.Type) bool {
+	ptr := reflect.PtrTo(typ)
+	if !ptr.Implements(marshaler) || !ptr.Implements(unmarshaler) {
+		return false
+	}
+
+	if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if !field.Anonymous {
+				continue
+			}
+			embedded := field.Type
+			if embedded.Kind() != reflect.Ptr {
+				embedded = reflect.PtrTo(embedded)
+			}
+			if embedded.Implements(marshaler) || embedded.Implements(unmarshaler) {
+				return false // The methods are, or may be, promoted from the embedded field
+			}
+		}
+	}
+
+	return true
+}
+
+var _ variableReadWriter = (*marshalerReadWriter)(nil)
+
+// marshalerReadWriter packs the result of MarshalBinary or MarshalText with a prefix indicating its length.
+type marshalerReadWriter struct {
+	variable
+	typ    reflect.Type
+	text   bool
+	prefix lengthPrefix
+}
+
+func (m *marshalerReadWriter) readVariable(r *reader, v reflect.Value) error {
+	var (
+		l   int
+		err error
+	)
+	if m.text {
+		l, err = r.readLength(m.prefix, "text size", r.opts.maxStringLength, ErrStringTooLong)
+	} else {
+		l, err = r.readLength(m.prefix, "binary size", r.opts.maxSliceLength, ErrSliceTooLong)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := r.next(l)
+	if err != nil {
+		return err
+	}
+
+	// Both interfaces require implementations to copy the data if they retain it, so passing the buffer is safe
+	if m.text {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+	return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+}
+
+func (m *marshalerReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	b, err := m.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := w.writeLength(m.prefix, len(b)); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (m *marshalerReadWriter) vLength(v reflect.Value) (int, error) {
+	b, err := m.marshal(v)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := m.prefix.bytes(len(b))
+	return size + len(b), err
+}
+
+func (m *marshalerReadWriter) marshal(v reflect.Value) ([]byte, error) {
+	if !v.CanAddr() {
+		// Map keys and values are not addressable, but the methods may be implemented on the pointer
+		c := reflect.New(m.typ).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	if m.text {
+		return v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+	}
+	return v.Addr().Interface().(encoding.BinaryMarshaler).MarshalBinary()
+}
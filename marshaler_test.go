@@ -0,0 +1,165 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// celsius is a named primitive, packed using its MarshalBinary rather than as a uint32.
+type celsius uint32
+
+func (c celsius) MarshalBinary() ([]byte, error) {
+	return []byte{byte(c)}, nil
+}
+
+func (c *celsius) UnmarshalBinary(b []byte) error {
+	if len(b) != 1 {
+		return errors.New("invalid celsius")
+	}
+	*c = celsius(b[0])
+	return nil
+}
+
+// preferPacker implements both Packer and BinaryMarshaler, of which Packer should win.
+type preferPacker struct {
+	A uint8
+}
+
+func (p *preferPacker) Pack(w io.Writer) error {
+	_, err := w.Write([]byte{p.A})
+	return err
+}
+
+func (p *preferPacker) Unpack(r io.Reader) error {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	p.A = b[0]
+	return err
+}
+
+func (p *preferPacker) MarshalBinary() ([]byte, error) {
+	return nil, errors.New("MarshalBinary should not have been called")
+}
+
+func (p *preferPacker) UnmarshalBinary([]byte) error {
+	return errors.New("UnmarshalBinary should not have been called")
+}
+
+func TestBinaryMarshaler(t *testing.T) {
+	type marshalers struct {
+		Temperature celsius
+		Addr        netip.Addr
+		URL         *url.URL
+		Custom      preferPacker
+		Readings    map[string]celsius
+	}
+
+	u, _ := url.Parse("https://example.com/path?q=1")
+	value := &marshalers{
+		Temperature: 21,
+		Addr:        netip.MustParseAddr("192.168.1.1"),
+		URL:         u,
+		Custom:      preferPacker{A: 7},
+		Readings:    map[string]celsius{"kitchen": 19},
+	}
+
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data[:5], []byte{0, 0, 0, 1, 21}) {
+		t.Errorf("Failing TestBinaryMarshaler, expected a length prefixed blob, got %x", data[:5])
+	}
+	if l, err := Len(value); err != nil || l != len(data) {
+		t.Errorf("Failing TestBinaryMarshaler, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(marshalers)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Temperature != 21 || result.Addr != value.Addr || result.URL.String() != u.String() ||
+		result.Custom.A != 7 || result.Readings["kitchen"] != 19 {
+		t.Errorf("Failing TestBinaryMarshaler, unexpected result %+v", result)
+	}
+
+	if err := Unmarshal([]byte{0, 0, 0, 2, 1, 2}, new(celsius)); err == nil || err.Error() != "invalid celsius" {
+		t.Errorf("Failing TestBinaryMarshaler, expected the UnmarshalBinary error, got %v", err)
+	}
+}
+
+func TestTextMarshaler(t *testing.T) {
+	type numbers struct {
+		Big []*big.Int `ikea:"text"`
+	}
+
+	value := &numbers{Big: []*big.Int{big.NewInt(12345)}}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 1, 0, 0, 0, 5, '1', '2', '3', '4', '5'}) {
+		t.Errorf("Failing TestTextMarshaler, expected the number as text, got %x", data)
+	}
+
+	result := new(numbers)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(result.Big) != 1 || result.Big[0].Int64() != 12345 {
+		t.Errorf("Failing TestTextMarshaler, unexpected result %v", result.Big)
+	}
+
+	// Without the option or tag, big.Int is packed as a plain struct, which has no exported fields
+	data, err = Marshal(big.NewInt(12345), TextMarshalers())
+	if err != nil || !bytes.Equal(data, []byte{0, 0, 0, 5, '1', '2', '3', '4', '5'}) {
+		t.Errorf("Failing TestTextMarshaler, expected the option to enable text marshalling, got %x (%v)", data, err)
+	}
+	if data, err = Marshal(big.NewInt(12345)); err != nil || len(data) != 0 {
+		t.Errorf("Failing TestTextMarshaler, expected big.Int to be packed as an empty struct, got %x (%v)", data, err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		N uint32 `ikea:"text"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestTextMarshaler, expected text on a uint32 to be rejected, got %v", err)
+	}
+}
+
+func TestEmbeddedMarshaler(t *testing.T) {
+	// The MarshalBinary of the embedded time is promoted to event, which should not hide Name
+	type event struct {
+		time.Time
+		Name string
+		Link *url.URL
+	}
+
+	link, _ := url.Parse("https://example.com/")
+	value := &event{Time: time.Unix(1, 0).UTC(), Name: "name", Link: link}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	result := new(event)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !result.Time.Equal(value.Time) || result.Name != "name" || result.Link.String() != link.String() {
+		t.Errorf("Failing TestEmbeddedMarshaler, expected %+v, got %+v", value, result)
+	}
+}
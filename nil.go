@@ -0,0 +1,183 @@
+package ikea
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// NilPolicy determines how nil pointers, slices and maps are packed.
+type NilPolicy uint8
+
+const (
+	// NilError refuses to pack nil values, returning a *NilValueError instead.
+	NilError NilPolicy = iota + 1
+	// NilZero packs nil values as the zero value of their type, so they can't be distinguished from it when unpacked.
+	// This does not change the packed format.
+	NilZero
+	// NilPresence prefixes the value with a byte indicating whether it is present, so nil values survive unpacking.
+	// In XDR mode, this is packed as 4 bytes, like an XDR optional-data.
+	NilPresence
+)
+
+func parseNilPolicy(s string) (NilPolicy, error) {
+	switch s {
+	case "error":
+		return NilError, nil
+	case "zero":
+		return NilZero, nil
+	case "presence":
+		return NilPresence, nil
+	default:
+		return 0, fmt.Errorf("unknown nil policy %q", s)
+	}
+}
+
+var _ variableReadWriter = (*presenceReadWriter)(nil)
+
+// presenceReadWriter implements NilPresence, it prefixes the value with a flag of size bytes that is 0 for nil and 1
+// otherwise.
+type presenceReadWriter struct {
+	variable
+	typ     reflect.Type
+	handler readWriter
+	size    int
+}
+
+func (p *presenceReadWriter) readVariable(r *reader, v reflect.Value) error {
+	present, err := readPresence(r, p.size)
+	if err != nil {
+		return err
+	}
+
+	if !present {
+		v.Set(reflect.Zero(p.typ))
+		return nil
+	}
+
+	return handleVariableReader(r, p.handler, v)
+}
+
+func (p *presenceReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if err := writePresence(w, !v.IsNil(), p.size); err != nil || v.IsNil() {
+		return err
+	}
+
+	return handleVariableWriter(w, p.handler, v)
+}
+
+func (p *presenceReadWriter) vLength(v reflect.Value) (int, error) {
+	if v.IsNil() {
+		return p.size, nil
+	}
+
+	l, err := handleVariableLength(p.handler, v)
+	return p.size + l, err
+}
+
+// readPresence reads a presence flag of size bytes, which holds 0 or 1 in its last byte.
+func readPresence(r *reader, size int) (bool, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range b[:size-1] {
+		if c != 0 {
+			return false, fmt.Errorf("invalid presence flag %x", b)
+		}
+	}
+
+	switch b[size-1] {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid presence flag %x", b)
+	}
+}
+
+func writePresence(w *writer, present bool, size int) error {
+	b := w.scratch(size)
+	if present {
+		b[size-1] = 1
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+var optionalPkgPath = reflect.TypeOf(Optional[bool]{}).PkgPath()
+
+// isOptional reports whether t is an instance of Optional. This compares the name rather than checking for a method,
+// as methods are promoted to structs that embed an Optional.
+func isOptional(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == optionalPkgPath && strings.HasPrefix(t.Name(), "Optional[")
+}
+
+// Optional holds a value that may be absent, it is packed as a presence byte that is followed by Value if Valid.
+type Optional[T any] struct {
+	Value T
+	Valid bool
+}
+
+// Some returns an Optional holding v.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Valid: true}
+}
+
+// Get returns the value and whether it is present.
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Valid
+}
+
+func getOptionalHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	h, err := getTypeHandler(t.Field(0).Type, cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return &optionalReadWriter{handler: h, size: cfg.presenceSize()}, nil
+}
+
+var _ variableReadWriter = (*optionalReadWriter)(nil)
+
+type optionalReadWriter struct {
+	variable
+	handler readWriter
+	size    int // Size of the presence flag
+}
+
+func (o *optionalReadWriter) readVariable(r *reader, v reflect.Value) error {
+	present, err := readPresence(r, o.size)
+	if err != nil {
+		return err
+	}
+
+	v.Field(1).SetBool(present)
+	if !present {
+		v.Field(0).Set(reflect.Zero(v.Field(0).Type()))
+		return nil
+	}
+
+	return handleVariableReader(r, o.handler, v.Field(0))
+}
+
+func (o *optionalReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	present := v.Field(1).Bool()
+	if err := writePresence(w, present, o.size); err != nil || !present {
+		return err
+	}
+
+	return handleVariableWriter(w, o.handler, v.Field(0))
+}
+
+func (o *optionalReadWriter) vLength(v reflect.Value) (int, error) {
+	if !v.Field(1).Bool() {
+		return o.size, nil
+	}
+
+	l, err := handleVariableLength(o.handler, v.Field(0))
+	return o.size + l, err
+}
@@ -0,0 +1,137 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNilPointerPolicies(t *testing.T) {
+	type optionalFields struct {
+		A *uint32
+		B *string `ikea:"nil:presence"`
+	}
+
+	// The tag on B only applies to B, so A still fails by default
+	var e *NilValueError
+	if err := Pack(new(bytes.Buffer), &optionalFields{}); !errors.As(err, &e) || e.Field != "A" {
+		t.Errorf("Failing TestNilPointerPolicies, expected a nil value error on A, got %v", err)
+	}
+
+	data, err := Marshal(&optionalFields{}, NilPointers(NilZero))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 0, 0}) {
+		t.Errorf("Failing TestNilPointerPolicies, zero policy should pack a zero uint32 and an absent string, got %x", data)
+	}
+
+	result := new(optionalFields)
+	if err := Unmarshal(data, result, NilPointers(NilZero)); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.A == nil || *result.A != 0 || result.B != nil {
+		t.Errorf("Failing TestNilPointerPolicies, unexpected result %+v", result)
+	}
+
+	s := "present"
+	data, err = Marshal(&optionalFields{B: &s}, NilPointers(NilPresence))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result = &optionalFields{A: new(uint32)}
+	if err := Unmarshal(data, result, NilPointers(NilPresence)); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.A != nil || result.B == nil || *result.B != s {
+		t.Errorf("Failing TestNilPointerPolicies, unexpected result %+v", result)
+	}
+	if l, err := Len(&optionalFields{B: &s}, NilPointers(NilPresence)); err != nil || l != len(data) {
+		t.Errorf("Failing TestNilPointerPolicies, Len reported %d (%v), should be %d", l, err, len(data))
+	}
+}
+
+func TestNilCollectionPolicies(t *testing.T) {
+	type collections struct {
+		A []byte
+		B map[string]string
+	}
+
+	for _, policy := range []NilPolicy{NilZero, NilPresence} {
+		data, err := Marshal(&collections{A: []byte{}}, NilCollections(policy))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		result := new(collections)
+		if err := Unmarshal(data, result, NilCollections(policy)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// Only the presence policy can restore B as nil
+		if result.A == nil || (result.B == nil) != (policy == NilPresence) {
+			t.Errorf("Failing TestNilCollectionPolicies, policy %d resulted in %#v", policy, result)
+		}
+	}
+
+	var e *NilValueError
+	if err := Pack(new(bytes.Buffer), &collections{A: []byte{}}, NilCollections(NilError)); !errors.As(err, &e) || e.Field != "B" {
+		t.Errorf("Failing TestNilCollectionPolicies, expected a nil value error on B, got %v", err)
+	}
+
+	var invalid struct {
+		A uint32 `ikea:"nil:presence"`
+	}
+	if _, ok := Check(reflect.TypeOf(invalid)).(*InvalidTagError); !ok {
+		t.Error("Failing TestNilCollectionPolicies, nil tag should be rejected on non-nillable types")
+	}
+}
+
+func TestOptional(t *testing.T) {
+	type withOptional struct {
+		A Optional[uint16]
+		B Optional[string]
+	}
+
+	data, err := Marshal(&withOptional{A: Some(uint16(0x1234))})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{1, 0x12, 0x34, 0}) {
+		t.Errorf("Failing TestOptional, unexpected output %x", data)
+	}
+
+	result := &withOptional{B: Some("overwritten")}
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if v, ok := result.A.Get(); !ok || v != 0x1234 {
+		t.Errorf("Failing TestOptional, A should be present with value 0x1234, got %+v", result.A)
+	}
+	if _, ok := result.B.Get(); ok || result.B.Value != "" {
+		t.Errorf("Failing TestOptional, B should be absent, got %+v", result.B)
+	}
+
+	// Structs embedding an Optional are packed as regular structs
+	type embedding struct {
+		Optional[int32]
+		X int32
+	}
+	embedded := &embedding{Optional: Some(int32(1)), X: 2}
+	if data, err = Marshal(embedded); err != nil || !bytes.Equal(data, []byte{1, 0, 0, 0, 1, 0, 0, 0, 2}) {
+		t.Errorf("Failing TestOptional, unexpected output %x for an embedded Optional (%v)", data, err)
+	}
+	embeddedResult := new(embedding)
+	if err := Unmarshal(data, embeddedResult); err != nil || *embeddedResult != *embedded {
+		t.Errorf("Failing TestOptional, expected %+v, got %+v (%v)", embedded, embeddedResult, err)
+	}
+}
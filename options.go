@@ -0,0 +1,281 @@
+package ikea
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSliceTooLong is returned when a decoded slice exceeds the length set using MaxSliceLength.
+	ErrSliceTooLong = errors.New("ikea: slice length exceeds limit")
+	// ErrStringTooLong is returned when a decoded string exceeds the length set using MaxStringLength.
+	ErrStringTooLong = errors.New("ikea: string length exceeds limit")
+	// ErrMapTooLarge is returned when a decoded map exceeds the amount of entries set using MaxMapEntries.
+	ErrMapTooLarge = errors.New("ikea: map entries exceed limit")
+	// ErrMessageTooLarge is returned when decoding a value would consume more bytes than set using MaxBytes.
+	ErrMessageTooLarge = errors.New("ikea: message size exceeds limit")
+	// ErrTooDeep is returned when a decoded value is nested deeper than set using MaxDepth.
+	ErrTooDeep = errors.New("ikea: nesting depth exceeds limit")
+	// ErrDecompressedTooLarge is returned when a compressed field inflates to more bytes than set using
+	// MaxDecompressedSize or its maxout tag.
+	ErrDecompressedTooLarge = errors.New("ikea: decompressed size exceeds limit")
+	// ErrCompressionRatio is returned when a compressed field inflates beyond the ratio set using MaxCompressionRatio.
+	ErrCompressionRatio = errors.New("ikea: compression ratio exceeds limit")
+)
+
+// Option configures the behaviour of an Encoder or Decoder, or of a single call to any of the other functions.
+// Some options, like the decoding limits, only apply to decoding. Options that change the packed format, like
+// NilPointers, have to be passed to both sides.
+type Option func(*options)
+
+type options struct {
+	cfg config
+
+	maxSliceLength  int
+	maxStringLength int
+	maxMapEntries   int
+	maxBytes        int64
+	maxDepth        int
+
+	maxDecompressed  int64
+	maxCompressRatio int64
+}
+
+var defaultOptions options
+
+func newOptions(opts []Option) *options {
+	if len(opts) == 0 {
+		return &defaultOptions
+	}
+
+	o := defaultOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
+
+// MaxSliceLength limits the length of decoded slices, the limit is checked before the slice is allocated.
+// A limit of 0 means no limit, which is the default.
+func MaxSliceLength(n int) Option {
+	return func(o *options) {
+		o.maxSliceLength = n
+	}
+}
+
+// MaxStringLength limits the length in bytes of decoded strings, the limit is checked before the string is allocated.
+// A limit of 0 means no limit, which is the default.
+func MaxStringLength(n int) Option {
+	return func(o *options) {
+		o.maxStringLength = n
+	}
+}
+
+// MaxMapEntries limits the amount of entries in decoded maps, the limit is checked before the map is allocated.
+// A limit of 0 means no limit, which is the default.
+func MaxMapEntries(n int) Option {
+	return func(o *options) {
+		o.maxMapEntries = n
+	}
+}
+
+// MaxBytes limits the amount of bytes a single value may consume from the stream, compressed fields count with their
+// compressed size. A limit of 0 means no limit, which is the default.
+func MaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// MaxDepth limits how deeply structs, slices and maps may be nested within a decoded value, which protects recursive
+// types from exhausting the stack. A limit of 0 means no limit, which is the default.
+func MaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// MaxDecompressedSize limits the amount of bytes a single compressed field may inflate to.
+// This can be overridden for a specific field using the maxout tag, like `ikea:"compress:9,maxout:1048576"`.
+// A limit of 0 means no limit, which is the default.
+func MaxDecompressedSize(n int64) Option {
+	return func(o *options) {
+		o.maxDecompressed = n
+	}
+}
+
+// MaxCompressionRatio limits the amount of bytes a compressed field may inflate to, relative to its compressed size.
+// With a ratio of 100, a compressed field of 1KiB may inflate to at most 100KiB.
+// A limit of 0 means no limit, which is the default.
+func MaxCompressionRatio(ratio int64) Option {
+	return func(o *options) {
+		o.maxCompressRatio = ratio
+	}
+}
+
+// config holds the options that influence the format of packed values. Handlers are built and cached per config,
+// so it has to remain comparable.
+type config struct {
+	nilPointers    NilPolicy
+	nilCollections NilPolicy
+	sortMaps       bool
+	timeUnit       time.Duration
+	timeZone       bool
+	textMarshalers bool
+	intSize        int
+	wire           reflect.Kind
+	varint         bool
+	lengths        lengthSize
+	lengthBits     int // The unsupported size passed to LengthSize, if any
+	order          Endianness
+	xdr            bool
+
+	// local holds the settings of a struct tag, which only apply to the outermost type of that field
+	local localConfig
+}
+
+type localConfig struct {
+	nilPolicy NilPolicy
+	fixedSize int
+	cstring   bool
+	rest      bool
+	lengths   lengthSize
+}
+
+// elem returns the config for the types nested within the current one, which drops the field local settings.
+func (c config) elem() config {
+	c.local = localConfig{}
+	return c
+}
+
+// options returns options holding this config, for handlers that have to pack values outside of an Encoder.
+func (c config) options() *options {
+	return &options{cfg: c.elem()}
+}
+
+// prefix returns how length prefixes are packed.
+func (c config) prefix() lengthPrefix {
+	size := c.lengths
+	if c.local.lengths != lengthDefault {
+		size = c.local.lengths
+	}
+	return lengthPrefix{size: size, order: c.order.byteOrder()}
+}
+
+// nilPolicy returns the policy that applies to nil values of type t.
+func (c config) nilPolicy(t reflect.Type) NilPolicy {
+	if c.local.nilPolicy != 0 {
+		return c.local.nilPolicy
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map:
+		if c.nilCollections != 0 {
+			return c.nilCollections
+		}
+		return NilZero
+	case reflect.Ptr:
+		if c.nilPointers != 0 {
+			return c.nilPointers
+		}
+	}
+
+	return NilError
+}
+
+// NilPointers sets how nil pointers are packed, the default is NilError.
+// This can be overridden for a specific field using the nil tag, like `ikea:"nil:presence"`.
+func NilPointers(policy NilPolicy) Option {
+	return func(o *options) {
+		o.cfg.nilPointers = policy
+	}
+}
+
+// NilCollections sets how nil slices and maps are packed, the default is NilZero, which packs them as empty.
+// This can be overridden for a specific field using the nil tag, like `ikea:"nil:presence"`.
+func NilCollections(policy NilPolicy) Option {
+	return func(o *options) {
+		o.cfg.nilCollections = policy
+	}
+}
+
+// IntSize makes int and uint be packed using the given amount of bits, which has to be 32 or 64.
+// This can also be set for the values within a specific field using a tag like `ikea:"int64"`.
+// Values that don't fit, either when packing or when unpacking on a platform with a smaller int, result in ErrOverflow.
+func IntSize(bits int) Option {
+	return func(o *options) {
+		o.cfg.intSize = bits
+	}
+}
+
+// ByteOrder sets the byte order in which numbers and length prefixes are packed, which is BigEndian by default.
+// This can also be set for the values within a specific field using the le and be tags, like `ikea:"le"`.
+// As this changes the format, it has to be passed when unpacking as well. Unknown values are treated as BigEndian.
+func ByteOrder(e Endianness) Option {
+	if e > NativeEndian {
+		e = BigEndian
+	}
+	return func(o *options) {
+		o.cfg.order = e
+	}
+}
+
+// LengthSize makes the lengths of slices, strings, maps and blobs be packed using the given amount of bits, which has
+// to be 8, 16, 32 (the default) or 64. Lengths that don't fit result in ErrOverflow when packing.
+// No size allows lengths beyond math.MaxInt32, so 64 bits only changes the format and does not raise that limit.
+// This can also be set for a specific field using a tag like `ikea:"len:uint16"`, which also accepts len:varint.
+// As this changes the format, it has to be passed when unpacking as well.
+// Other sizes result in an *UnsupportedTypeError when packing or unpacking.
+func LengthSize(bits int) Option {
+	size, err := parseLengthSize("uint" + strconv.Itoa(bits))
+	invalid := 0
+	if err != nil {
+		size, invalid = lengthInvalid, bits
+	}
+	return func(o *options) {
+		o.cfg.lengths, o.cfg.lengthBits = size, invalid
+	}
+}
+
+// VarintLengths makes the lengths of slices, strings, maps and blobs be packed as unsigned varints rather than as
+// uint32, which saves bytes on short values.
+// As this changes the format, it has to be passed when unpacking as well.
+func VarintLengths() Option {
+	return func(o *options) {
+		o.cfg.lengths, o.cfg.lengthBits = lengthVarint, 0
+	}
+}
+
+// XDR makes values be packed as XDR (RFC 4506), which differs from the default format in a few ways:
+// bools, presence flags and integers smaller than 32 bits are packed as 4 bytes, byte arrays are packed as
+// fixed-length opaque data, and strings, byte slices and other blobs are padded with zeroes to a multiple of 4 bytes.
+// Interface type ids are packed as 4 bytes as well. Options and tags that change the format otherwise, like
+// VarintLengths or the bits tag, still apply, which results in data that is no longer valid XDR.
+// As this changes the format, it has to be passed when unpacking as well.
+func XDR() Option {
+	return func(o *options) {
+		o.cfg.xdr = true
+	}
+}
+
+// TextMarshalers makes types that implement encoding.TextMarshaler and encoding.TextUnmarshaler, but not their binary
+// counterparts, be packed as their text form prefixed by its length.
+// This can also be enabled for the values within a specific field using the text tag, like `ikea:"text"`.
+// As this changes the format, it has to be passed when unpacking as well.
+func TextMarshalers() Option {
+	return func(o *options) {
+		o.cfg.textMarshalers = true
+	}
+}
+
+// SortMapKeys makes map entries be packed in order of their keys, so equal maps always result in the same bytes.
+// Keys of primitive types and strings are ordered naturally, all others are ordered by their packed bytes.
+// This can also be enabled for the maps within a specific field using the sorted tag, like `ikea:"sorted"`.
+// Unpacking is not affected by this option.
+func SortMapKeys() Option {
+	return func(o *options) {
+		o.cfg.sortMaps = true
+	}
+}
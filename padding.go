@@ -0,0 +1,71 @@
+package ikea
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ErrLayoutMismatch is returned by CheckLayout when the packed form of a type differs from its memory layout.
+var ErrLayoutMismatch = errors.New("ikea: packed layout differs from memory layout")
+
+// parsePadding parses the value of a pad or align tag, which has to be a positive amount of bytes.
+func parsePadding(name, s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s size %q", name, s)
+	}
+	return n, nil
+}
+
+// padding returns the amount of zero bytes packed in front of the field, when it starts at offset bytes from the
+// start of the struct.
+func (f *structField) padding(offset int) int {
+	n := f.pad
+	if f.align > 0 {
+		n += (f.align - (offset+n)%f.align) % f.align
+	}
+	return n
+}
+
+var _ fixedReadWriter = (*blankReadWriter)(nil)
+
+// blankReadWriter packs nothing, it is the handler of blank fields that are only there for their padding.
+type blankReadWriter struct {
+	fixed
+}
+
+func (blankReadWriter) length() int {
+	return 0
+}
+
+func (blankReadWriter) readFixed([]byte, reflect.Value) error {
+	return nil
+}
+
+func (blankReadWriter) writeFixed([]byte, reflect.Value) error {
+	return nil
+}
+
+// CheckLayout verifies that struct type t packs to a fixed size equal to its size in memory, as returned by
+// unsafe.Sizeof, using opts. This allows verifying that the pad and align tags of a type mirroring a C struct match
+// the layout of that struct, assuming the Go type has the same memory layout.
+func CheckLayout(t reflect.Type, opts ...Option) error {
+	if t == nil {
+		return &NilValueError{Type: t}
+	}
+	h, err := getTypeHandler(t, newOptions(opts).cfg)
+	if err != nil {
+		return err
+	}
+
+	if !h.isFixed() {
+		return fmt.Errorf("%w: %s does not have a fixed size", ErrLayoutMismatch, t)
+	}
+	if size := h.(fixedReadWriter).length(); uintptr(size) != t.Size() {
+		return fmt.Errorf("%w: %s packs to %d bytes, but has a size of %d", ErrLayoutMismatch, t, size, t.Size())
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPadding(t *testing.T) {
+	// Mirrors struct { uint8_t kind; uint32_t length; uint16_t flags; } as laid out by a C compiler
+	type header struct {
+		Kind   uint8
+		Length uint32 `ikea:"align:4"`
+		Flags  uint16
+		_      [2]byte `ikea:"pad:2"`
+	}
+
+	h, err := getTypeHandler(reflect.TypeOf(header{}), config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !h.isFixed() || h.(fixedReadWriter).length() != 12 {
+		t.Errorf("Failing TestPadding, expected a fixed handler of 12 bytes, got %T", h)
+	}
+	if err := CheckLayout(reflect.TypeOf(header{}), ByteOrder(NativeEndian)); err != nil {
+		t.Errorf("Failing TestPadding, expected the layout to match, got %v", err)
+	}
+
+	value := &header{Kind: 1, Length: 2, Flags: 3}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{1, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0, 0}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestPadding, expected %x, got %x", expected, data)
+	}
+
+	// Padding is skipped without being verified
+	data[1], data[11] = 0xFF, 0xFF
+	result := new(header)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestPadding, expected %+v, got %+v", value, result)
+	}
+}
+
+func TestVariablePadding(t *testing.T) {
+	type record struct {
+		Name string `ikea:"len:uint8"`
+		ID   uint32 `ikea:"align:4"`
+		Data []byte `ikea:"pad:1,len:uint8"`
+	}
+
+	value := &record{Name: "ab", ID: 5, Data: []byte{6}}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{2, 'a', 'b', 0, 0, 0, 0, 5, 0, 1, 6}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestVariablePadding, expected %x, got %x", expected, data)
+	}
+	if l, err := Len(value); err != nil || l != len(data) {
+		t.Errorf("Failing TestVariablePadding, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(record)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestVariablePadding, expected %+v, got %+v", value, result)
+	}
+}
+
+func TestInvalidPadding(t *testing.T) {
+	if err := CheckLayout(reflect.TypeOf(struct {
+		A uint8
+		B uint32
+	}{})); !errors.Is(err, ErrLayoutMismatch) {
+		t.Errorf("Failing TestInvalidPadding, expected missing padding to be reported, got %v", err)
+	}
+	if err := CheckLayout(reflect.TypeOf(struct{ A string }{})); !errors.Is(err, ErrLayoutMismatch) {
+		t.Errorf("Failing TestInvalidPadding, expected a variable struct to be reported, got %v", err)
+	}
+
+	for _, v := range []interface{}{
+		struct {
+			A uint8 `ikea:"pad:0"`
+		}{},
+		struct {
+			A uint8 `ikea:"align"`
+		}{},
+		struct {
+			A uint8 `ikea:"bits:2,pad:1"`
+		}{},
+	} {
+		var te *InvalidTagError
+		if err := Check(reflect.TypeOf(v)); !errors.As(err, &te) {
+			t.Errorf("Failing TestInvalidPadding, expected %T to be rejected, got %v", v, err)
+		}
+	}
+}
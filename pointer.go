@@ -1,13 +1,24 @@
 package ikea
 
 import (
-	"io"
 	"reflect"
 )
 
-func getPointerHandlerFromType(t reflect.Type) readWriter {
+func getPointerHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
 	e := t.Elem()
-	return &pointerWrapper{getTypeHandler(e), e}
+	h, err := getTypeHandler(e, cfg.elem())
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.nilPolicy(t) {
+	case NilPresence:
+		return &presenceReadWriter{typ: t, handler: &pointerWrapper{h, e, false}, size: cfg.presenceSize()}, nil
+	case NilZero:
+		return &pointerWrapper{h, e, true}, nil
+	default:
+		return &pointerWrapper{h, e, false}, nil
+	}
 }
 
 var _ fixedReadWriter = (*pointerWrapper)(nil)
@@ -15,48 +26,64 @@ var _ variableReadWriter = (*pointerWrapper)(nil)
 
 type pointerWrapper struct {
 	readWriter
-	typ reflect.Type
+	typ  reflect.Type
+	zero bool // Pack nil as the zero value of typ, rather than returning an error
+}
+
+// elem returns the value v points to, nil pointers result in a new zero value or an error, depending on the policy.
+func (p *pointerWrapper) elem(v reflect.Value) (reflect.Value, error) {
+	if !v.IsNil() {
+		return v.Elem(), nil
+	}
+	if p.zero {
+		return reflect.New(p.typ).Elem(), nil // Addressable, unlike reflect.Zero, as custom Packers require it
+	}
+
+	return v, &NilValueError{Type: v.Type()}
 }
 
 func (p *pointerWrapper) isFixed() bool {
 	return p.readWriter.isFixed()
 }
 
-func (p *pointerWrapper) vLength(v reflect.Value) int {
-	if v.IsNil() {
-		panic("Attempting to get Len of nil value")
+func (p *pointerWrapper) vLength(v reflect.Value) (int, error) {
+	e, err := p.elem(v)
+	if err != nil {
+		return 0, err
 	}
-	return p.readWriter.(variableReadWriter).vLength(v.Elem())
+	return p.readWriter.(variableReadWriter).vLength(e)
 }
 
-func (p *pointerWrapper) readVariable(r io.Reader, v reflect.Value) error {
+func (p *pointerWrapper) readVariable(r *reader, v reflect.Value) error {
 	if v.IsNil() {
 		v.Set(reflect.New(p.typ))
 	}
 	return p.readWriter.(variableReadWriter).readVariable(r, v.Elem())
 }
 
-func (p *pointerWrapper) writeVariable(w io.Writer, v reflect.Value) error {
-	if v.IsNil() {
-		panic("Attempting to marshal nil value")
+func (p *pointerWrapper) writeVariable(w *writer, v reflect.Value) error {
+	e, err := p.elem(v)
+	if err != nil {
+		return err
 	}
-	return p.readWriter.(variableReadWriter).writeVariable(w, v.Elem())
+	return p.readWriter.(variableReadWriter).writeVariable(w, e)
 }
 
 func (p *pointerWrapper) length() int {
 	return p.readWriter.(fixedReadWriter).length()
 }
 
-func (p *pointerWrapper) readFixed(b []byte, v reflect.Value) {
+func (p *pointerWrapper) readFixed(b []byte, v reflect.Value) error {
 	if v.IsNil() {
 		v.Set(reflect.New(p.typ))
 	}
-	p.readWriter.(fixedReadWriter).readFixed(b, v.Elem())
+	return p.readWriter.(fixedReadWriter).readFixed(b, v.Elem())
 }
 
-func (p *pointerWrapper) writeFixed(b []byte, v reflect.Value) {
-	if v.IsNil() {
-		panic("Attempting to marshal nil value")
+func (p *pointerWrapper) writeFixed(b []byte, v reflect.Value) error {
+	e, err := p.elem(v)
+	if err != nil {
+		return err
 	}
-	p.readWriter.(fixedReadWriter).writeFixed(b, v.Elem())
+	return p.readWriter.(fixedReadWriter).writeFixed(b, e)
 }
@@ -12,29 +12,52 @@ type primitiveReadWriter struct {
 	fixed
 
 	size   int
-	reader func([]byte, reflect.Value)
-	writer func([]byte, reflect.Value)
+	order  binary.ByteOrder
+	reader func(binary.ByteOrder, []byte, reflect.Value)
+	writer func(binary.ByteOrder, []byte, reflect.Value)
 }
 
 func (p *primitiveReadWriter) length() int {
 	return p.size
 }
 
-func (p *primitiveReadWriter) readFixed(data []byte, v reflect.Value) {
-	p.reader(data, v)
+func (p *primitiveReadWriter) readFixed(data []byte, v reflect.Value) error {
+	p.reader(p.order, data, v)
+	return nil
 }
 
-func (p *primitiveReadWriter) writeFixed(data []byte, v reflect.Value) {
-	p.writer(data, v)
+func (p *primitiveReadWriter) writeFixed(data []byte, v reflect.Value) error {
+	p.writer(p.order, data, v)
+	return nil
 }
 
-var primitiveIndex = map[reflect.Kind]*primitiveReadWriter{
+// primitiveIndex holds the handlers of all primitives per byte order, see init.
+var primitiveIndex [NativeEndian + 1]map[reflect.Kind]fixedReadWriter
+
+func init() {
+	for i := range primitiveIndex {
+		e := Endianness(i)
+		primitiveIndex[e] = make(map[reflect.Kind]fixedReadWriter, len(primitives))
+		for kind, p := range primitives {
+			h := &primitiveReadWriter{size: p.size, order: e.byteOrder(), reader: p.reader, writer: p.writer}
+			if e == NativeEndian && kind != reflect.Bool {
+				// Bools are excluded, as any byte other than 0 or 1 would make an invalid bool
+				primitiveIndex[e][kind] = &rawReadWriter{h}
+			} else {
+				primitiveIndex[e][kind] = h
+			}
+		}
+	}
+}
+
+// primitives holds the size and functions to convert each primitive, for any byte order.
+var primitives = map[reflect.Kind]primitiveReadWriter{
 	reflect.Bool: {
 		size: 1,
-		reader: func(b []byte, v reflect.Value) {
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			v.SetBool(b[0] != 0)
 		},
-		writer: func(b []byte, v reflect.Value) {
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			if v.Bool() {
 				b[0] = 1
 			}
@@ -42,92 +65,92 @@ var primitiveIndex = map[reflect.Kind]*primitiveReadWriter{
 	},
 	reflect.Int8: {
 		size: 1,
-		reader: func(b []byte, v reflect.Value) {
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			v.SetInt(int64(b[0]))
 		},
-		writer: func(b []byte, v reflect.Value) {
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			b[0] = byte(v.Int())
 		},
 	},
 	reflect.Int16: {
 		size: 2,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetInt(int64(binary.BigEndian.Uint16(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetInt(int64(order.Uint16(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint16(b, uint16(v.Int()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint16(b, uint16(v.Int()))
 		},
 	},
 	reflect.Int32: {
 		size: 4,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetInt(int64(binary.BigEndian.Uint32(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetInt(int64(order.Uint32(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint32(b, uint32(v.Int()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint32(b, uint32(v.Int()))
 		},
 	},
 	reflect.Int64: {
 		size: 8,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetInt(int64(binary.BigEndian.Uint64(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetInt(int64(order.Uint64(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint64(b, uint64(v.Int()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint64(b, uint64(v.Int()))
 		},
 	},
 	reflect.Uint8: {
 		size: 1,
-		reader: func(b []byte, v reflect.Value) {
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			v.SetUint(uint64(b[0]))
 		},
-		writer: func(b []byte, v reflect.Value) {
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
 			b[0] = byte(v.Uint())
 		},
 	},
 	reflect.Uint16: {
 		size: 2,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetUint(uint64(binary.BigEndian.Uint16(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetUint(uint64(order.Uint16(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint16(b, uint16(v.Uint()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint16(b, uint16(v.Uint()))
 		},
 	},
 	reflect.Uint32: {
 		size: 4,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetUint(uint64(binary.BigEndian.Uint32(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetUint(uint64(order.Uint32(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint32(b, uint32(v.Uint()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint32(b, uint32(v.Uint()))
 		},
 	},
 	reflect.Uint64: {
 		size: 8,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetUint(binary.BigEndian.Uint64(b))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetUint(order.Uint64(b))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint64(b, v.Uint())
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint64(b, v.Uint())
 		},
 	},
 	reflect.Float32: {
 		size: 4,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(b))))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetFloat(float64(math.Float32frombits(order.Uint32(b))))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint32(b, math.Float32bits(float32(v.Float())))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint32(b, math.Float32bits(float32(v.Float())))
 		},
 	},
 	reflect.Float64: {
 		size: 8,
-		reader: func(b []byte, v reflect.Value) {
-			v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		reader: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			v.SetFloat(math.Float64frombits(order.Uint64(b)))
 		},
-		writer: func(b []byte, v reflect.Value) {
-			binary.BigEndian.PutUint64(b, math.Float64bits(v.Float()))
+		writer: func(order binary.ByteOrder, b []byte, v reflect.Value) {
+			order.PutUint64(b, math.Float64bits(v.Float()))
 		},
 	},
 }
@@ -79,6 +79,33 @@ func TestString(t *testing.T) {
 	typeTest(t, "TestString", &s, s)
 }
 
+func TestArray(t *testing.T) {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	typeTest(t, "TestArray", &uuid, uuid)
+
+	vector := [3]float32{rand.Float32(), rand.Float32(), rand.Float32()}
+	typeTest(t, "TestArray", &vector, vector)
+
+	names := [2]string{"abc", "defg"}
+	typeTest(t, "TestArray", &names, names)
+
+	type record struct {
+		ID       [16]byte
+		Position [3]float32
+	}
+	h, err := getTypeHandler(reflect.TypeOf(record{}), config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fh, ok := h.(*fixedStructReadWriter); !ok || fh.length() != 28 {
+		t.Errorf("Failing TestArray, a struct of fixed arrays should be fixed with a length of 28")
+	}
+	rec := record{ID: uuid, Position: vector}
+	typeTest(t, "TestArray", &rec, rec)
+}
+
 func typeTest(t *testing.T, typ string, value, compare interface{}) {
 	var b bytes.Buffer
 
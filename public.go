@@ -1,36 +1,97 @@
 package ikea
 
 import (
+	"bytes"
+	"errors"
 	"io"
-	"reflect"
 )
 
+// ErrTrailingData is returned by Unmarshal when data contains more bytes than the value consumed.
+var ErrTrailingData = errors.New("trailing data after unpacked value")
+
 // Unpack will read exactly enough bytes from the specified Reader in order to fill the value passed to data.
-// if data is not a pointer Unpack will panic
-func Unpack(r io.Reader, data interface{}) error {
-	pv := reflect.ValueOf(data)
-	if pv.Kind() != reflect.Ptr {
-		panic("passed data argument is not a pointer")
+// The format and decoding limits can be configured using opts.
+// io.EOF is only returned if r had no bytes left at all, if it ends halfway through the value io.ErrUnexpectedEOF is returned.
+// if data is not a non-nil pointer Unpack will return an *InvalidUnpackError
+func Unpack(r io.Reader, data interface{}, opts ...Option) error {
+	return decode(readerFor(r, opts), data)
+}
+
+// Unmarshal will fill the value passed to data from the packed bytes in b.
+// Unlike Unpack, all of b has to be consumed, any leftover bytes will result in ErrTrailingData.
+// The format and decoding limits can be configured using opts.
+// if data is not a non-nil pointer Unmarshal will return an *InvalidUnpackError
+func Unmarshal(b []byte, data interface{}, opts ...Option) error {
+	r := bytes.NewReader(b)
+	if err := decode(&reader{r: r, opts: newOptions(opts)}, data); err != nil {
+		return err
+	}
+
+	if r.Len() != 0 {
+		return ErrTrailingData
 	}
 
-	v := pv.Elem()
-	h := getTypeHandler(v.Type())
+	return nil
+}
+
+// Pack will write the value passed in data to the specified Writer, the format can be configured using opts
+func Pack(w io.Writer, data interface{}, opts ...Option) error {
+	return encode(writerFor(w, opts), data)
+}
 
-	return handleVariableReader(r, h, v)
+// Marshal will return the packed bytes of data, the returned slice is allocated exactly once using Len.
+func Marshal(data interface{}, opts ...Option) ([]byte, error) {
+	return AppendPack(nil, data, opts...)
 }
 
-// Pack will write the value passed in data to the specified Writer
-func Pack(w io.Writer, data interface{}) error {
-	v := reflect.Indirect(reflect.ValueOf(data))
-	h := getTypeHandler(v.Type())
+// AppendPack will append the packed bytes of data to dst and return the extended slice.
+// dst will grow at most once, as the required space is determined up front using Len.
+func AppendPack(dst []byte, data interface{}, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	h, v, err := handlerForValue(data, o)
+	if err != nil {
+		return dst, err
+	}
+
+	l, err := handleVariableLength(h, v)
+	if err != nil {
+		return dst, withRoot(err, v.Type(), 0)
+	}
+	if cap(dst)-len(dst) < l {
+		grown := make([]byte, len(dst), len(dst)+l)
+		copy(grown, dst)
+		dst = grown
+	}
 
-	return handleVariableWriter(w, h, v)
+	a := &appendWriter{b: dst}
+	if err := handleVariableWriter(&writer{w: a, opts: o}, h, v); err != nil {
+		return dst, withRoot(err, v.Type(), 0)
+	}
+
+	return a.b, nil
 }
 
 // Len will return the amount of bytes Pack will use.
-func Len(data interface{}) int {
-	v := reflect.Indirect(reflect.ValueOf(data))
-	h := getTypeHandler(v.Type())
+// It returns an error in the same cases Pack would, such as unsupported types or nil values.
+func Len(data interface{}, opts ...Option) (int, error) {
+	h, v, err := handlerForValue(data, newOptions(opts))
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := handleVariableLength(h, v)
+	if err != nil {
+		return 0, withRoot(err, v.Type(), 0)
+	}
+	return l, nil
+}
+
+// appendWriter is an io.Writer that appends to a byte slice, used by AppendPack.
+type appendWriter struct {
+	b []byte
+}
 
-	return handleVariableLength(h, v)
+func (a *appendWriter) Write(p []byte) (int, error) {
+	a.b = append(a.b, p...)
+	return len(p), nil
 }
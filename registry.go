@@ -0,0 +1,192 @@
+package ikea
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+type registeredType struct {
+	id  uint16
+	typ reflect.Type
+}
+
+var (
+	registryByID   = make(map[uint16]*registeredType)
+	registryByType = make(map[reflect.Type]*registeredType)
+	registryLock   sync.RWMutex
+)
+
+// RegisterType registers the type of prototype under id, which allows it to be packed into interface typed fields.
+// Those fields are packed as the uint16 id (4 bytes in XDR mode), followed by the value itself.
+// Both the id and the type can only be registered once, pointer types are registered separately from their element.
+func RegisterType(id uint16, prototype interface{}) error {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		return &NilValueError{Type: t}
+	}
+
+	// Validate the type using the default config, other configs are looked up when the type is used
+	if _, err := getTypeHandler(t, config{}); err != nil {
+		return err
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if existing, ok := registryByID[id]; ok {
+		return fmt.Errorf("ikea: type id %d is already registered to %s", id, existing.typ)
+	}
+	if existing, ok := registryByType[t]; ok {
+		return fmt.Errorf("ikea: type %s is already registered with id %d", t, existing.id)
+	}
+
+	info := &registeredType{id: id, typ: t}
+	registryByID[id] = info
+	registryByType[t] = info
+
+	return nil
+}
+
+// UnregisteredTypeError is returned when an interface field holds a value of a type that was not registered using
+// RegisterType.
+type UnregisteredTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnregisteredTypeError) Error() string {
+	return fmt.Sprintf("ikea: type %s is not registered", e.Type)
+}
+
+// UnknownTypeIDError is returned when an interface field is unpacked with a type id that was not registered using
+// RegisterType, or with a type that does not implement the interface of the field.
+type UnknownTypeIDError struct {
+	ID        uint16
+	Interface reflect.Type
+}
+
+func (e *UnknownTypeIDError) Error() string {
+	registryLock.RLock()
+	info, ok := registryByID[e.ID]
+	registryLock.RUnlock()
+
+	if ok {
+		return fmt.Sprintf("ikea: type id %d (%s) does not implement %s", e.ID, info.typ, e.Interface)
+	}
+	return fmt.Sprintf("ikea: unknown type id %d", e.ID)
+}
+
+func getInterfaceHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	var h readWriter = &interfaceReadWriter{typ: t, cfg: cfg.elem()}
+
+	switch cfg.nilPolicy(t) {
+	case NilPresence:
+		h = &presenceReadWriter{typ: t, handler: h, size: cfg.presenceSize()}
+	case NilZero:
+		return nil, &UnsupportedTypeError{Type: t, Hint: "interfaces have no zero value to pack in place of nil"}
+	}
+
+	return h, nil
+}
+
+var _ variableReadWriter = (*interfaceReadWriter)(nil)
+
+type interfaceReadWriter struct {
+	variable
+	typ reflect.Type
+	cfg config // The registered types are looked up when used, using this config
+}
+
+func (i *interfaceReadWriter) readVariable(r *reader, v reflect.Value) error {
+	var id uint16
+	if i.cfg.xdr {
+		b, err := r.next(4)
+		if err != nil {
+			return err
+		}
+		wide := i.cfg.order.byteOrder().Uint32(b)
+		if wide > math.MaxUint16 {
+			return fmt.Errorf("%w: type id %d", ErrOverflow, wide)
+		}
+		id = uint16(wide)
+	} else {
+		b, err := r.next(2)
+		if err != nil {
+			return err
+		}
+		id = i.cfg.order.byteOrder().Uint16(b)
+	}
+
+	registryLock.RLock()
+	info, ok := registryByID[id]
+	registryLock.RUnlock()
+	if !ok || !info.typ.AssignableTo(i.typ) {
+		return &UnknownTypeIDError{ID: id, Interface: i.typ}
+	}
+
+	h, err := getTypeHandler(info.typ, i.cfg)
+	if err != nil {
+		return err
+	}
+
+	value := reflect.New(info.typ).Elem()
+	if err := handleVariableReader(r, h, value); err != nil {
+		return err
+	}
+
+	v.Set(value)
+	return nil
+}
+
+func (i *interfaceReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	info, h, err := i.concrete(v)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	if i.cfg.xdr {
+		b = w.scratch(4)
+		i.cfg.order.byteOrder().PutUint32(b, uint32(info.id))
+	} else {
+		b = w.scratch(2)
+		i.cfg.order.byteOrder().PutUint16(b, info.id)
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+
+	return handleVariableWriter(w, h, addressable(v.Elem()))
+}
+
+func (i *interfaceReadWriter) vLength(v reflect.Value) (int, error) {
+	_, h, err := i.concrete(v)
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := handleVariableLength(h, addressable(v.Elem()))
+	if i.cfg.xdr {
+		return 4 + l, err
+	}
+	return 2 + l, err
+}
+
+// concrete looks up the registration and handler of the value held by v.
+func (i *interfaceReadWriter) concrete(v reflect.Value) (*registeredType, readWriter, error) {
+	if v.IsNil() {
+		return nil, nil, &NilValueError{Type: i.typ}
+	}
+
+	t := v.Elem().Type()
+	registryLock.RLock()
+	info, ok := registryByType[t]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, nil, &UnregisteredTypeError{Type: t}
+	}
+
+	h, err := getTypeHandler(t, i.cfg)
+	return info, h, err
+}
@@ -0,0 +1,172 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type testEventPayload interface {
+	eventName() string
+}
+
+type testLoginEvent struct {
+	User string
+}
+
+func (testLoginEvent) eventName() string { return "login" }
+
+type testLogoutEvent struct {
+	User   string
+	Reason uint8
+}
+
+func (*testLogoutEvent) eventName() string { return "logout" }
+
+type testUnregisteredEvent struct{}
+
+func (testUnregisteredEvent) eventName() string { return "unregistered" }
+
+// testPackedEvent implements Packer and Unpacker on its pointer, but is held by value.
+type testPackedEvent struct {
+	Code uint8
+}
+
+func (testPackedEvent) eventName() string { return "packed" }
+
+func (p *testPackedEvent) Pack(w io.Writer) error {
+	_, err := w.Write([]byte{p.Code, p.Code})
+	return err
+}
+
+func (p *testPackedEvent) Unpack(r io.Reader) error {
+	var b [2]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	p.Code = b[0]
+	return nil
+}
+
+type testEvent struct {
+	ID      uint32
+	Payload testEventPayload
+}
+
+func init() {
+	if err := RegisterType(1, testLoginEvent{}); err != nil {
+		panic(err)
+	}
+	if err := RegisterType(2, &testLogoutEvent{}); err != nil {
+		panic(err)
+	}
+	if err := RegisterType(3, uint64(0)); err != nil {
+		panic(err)
+	}
+	if err := RegisterType(4, testPackedEvent{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestInterfaceField(t *testing.T) {
+	events := []testEvent{
+		{ID: 1, Payload: testLoginEvent{User: "ikkerens"}},
+		{ID: 2, Payload: &testLogoutEvent{User: "ikkerens", Reason: 3}},
+	}
+
+	for _, event := range events {
+		data, err := Marshal(&event)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		result := new(testEvent)
+		if err := Unmarshal(data, result); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if result.Payload.eventName() != event.Payload.eventName() {
+			t.Errorf("Failing TestInterfaceField, decoded %T does not match %T", result.Payload, event.Payload)
+		}
+	}
+
+	data, err := Marshal(&events[1])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result := new(testEvent)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if logout, ok := result.Payload.(*testLogoutEvent); !ok || *logout != *events[1].Payload.(*testLogoutEvent) {
+		t.Errorf("Failing TestInterfaceField, decoded value %+v does not match %+v", result.Payload, events[1].Payload)
+	}
+}
+
+func TestInterfacePacker(t *testing.T) {
+	// Values held by interfaces and maps are not addressable, so they can't be passed to a Packer directly
+	event := &testEvent{ID: 1, Payload: testPackedEvent{Code: 7}}
+	data, err := Marshal(event)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 1, 0, 4, 7, 7}) {
+		t.Errorf("Failing TestInterfacePacker, unexpected output %x", data)
+	}
+	if l, err := Len(event); err != nil || l != len(data) {
+		t.Errorf("Failing TestInterfacePacker, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(testEvent)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Payload != event.Payload {
+		t.Errorf("Failing TestInterfacePacker, expected %+v, got %+v", event.Payload, result.Payload)
+	}
+
+	m := map[string]testPackedEvent{"a": {Code: 1}}
+	if data, err = Marshal(m); err != nil || !bytes.Equal(data, []byte{0, 0, 0, 1, 0, 0, 0, 1, 'a', 1, 1}) {
+		t.Errorf("Failing TestInterfacePacker, unexpected output %x for a map (%v)", data, err)
+	}
+	mapResult := make(map[string]testPackedEvent)
+	if err := Unmarshal(data, &mapResult); err != nil || mapResult["a"] != m["a"] {
+		t.Errorf("Failing TestInterfacePacker, expected %+v, got %+v (%v)", m, mapResult, err)
+	}
+}
+
+func TestInterfaceFieldErrors(t *testing.T) {
+	if err := RegisterType(1, testUnregisteredEvent{}); err == nil {
+		t.Error("TestInterfaceFieldErrors should not allow an id to be registered twice")
+	}
+	if err := RegisterType(100, testLoginEvent{}); err == nil {
+		t.Error("TestInterfaceFieldErrors should not allow a type to be registered twice")
+	}
+
+	var unregistered *UnregisteredTypeError
+	if err := Pack(new(bytes.Buffer), &testEvent{Payload: testUnregisteredEvent{}}); !errors.As(err, &unregistered) {
+		t.Errorf("TestInterfaceFieldErrors should have failed due to an unregistered type, got %v", err)
+	}
+
+	var nilValue *NilValueError
+	if err := Pack(new(bytes.Buffer), &testEvent{}); !errors.As(err, &nilValue) {
+		t.Errorf("TestInterfaceFieldErrors should have failed due to a nil interface, got %v", err)
+	}
+
+	var unknown *UnknownTypeIDError
+	if err := Unmarshal([]byte{0, 0, 0, 1, 0xFF, 0xFF}, new(testEvent)); !errors.As(err, &unknown) || unknown.ID != 0xFFFF {
+		t.Errorf("TestInterfaceFieldErrors should have failed due to an unknown type id, got %v", err)
+	}
+
+	// uint64 is registered, but does not implement testEventPayload
+	if err := Unmarshal([]byte{0, 0, 0, 1, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0}, new(testEvent)); !errors.As(err, &unknown) {
+		t.Errorf("TestInterfaceFieldErrors should have failed due to a type not implementing the interface, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package ikea
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var _ variableReadWriter = (*restReadWriter)(nil)
+
+// restReadWriter packs strings and byte slices without a length prefix, they are unpacked from all remaining bytes.
+// This is only allowed for the last field of a struct.
+type restReadWriter struct {
+	variable
+	str bool
+}
+
+func (s *restReadWriter) readVariable(r *reader, v reflect.Value) error {
+	max, limitErr := r.opts.maxSliceLength, ErrSliceTooLong
+	if s.str {
+		max, limitErr = r.opts.maxStringLength, ErrStringTooLong
+	}
+
+	var buf []byte
+	chunk := make([]byte, 512)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if max > 0 && len(buf) > max {
+			return fmt.Errorf("%w (>%d)", limitErr, max)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil && r.limit > 0 && r.n >= r.limit && err == r.limitErr {
+			// The limit is only exceeded if there is more data beyond it
+			if _, err := io.ReadFull(r.r, chunk[:1]); err == io.EOF {
+				break
+			}
+			return r.limitErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return setByteString(v, buf, s.str)
+}
+
+func (s *restReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	var err error
+	if s.str {
+		_, err = io.WriteString(w, v.String())
+	} else {
+		_, err = w.Write(v.Bytes())
+	}
+	return err
+}
+
+func (s *restReadWriter) vLength(v reflect.Value) (int, error) {
+	return v.Len(), nil
+}
+
+// packedBy returns the handler that h passes its values on to, unwrapping pointers, optionals and fallbacks.
+func packedBy(h readWriter) readWriter {
+	for {
+		switch inner := h.(type) {
+		case *customReadWriter:
+			if inner.fallback == nil {
+				return h
+			}
+			h = inner.fallback
+		case *pointerWrapper:
+			h = inner.readWriter
+		case *presenceReadWriter:
+			h = inner.handler
+		case *optionalReadWriter:
+			h = inner.handler
+		default:
+			return h
+		}
+	}
+}
+
+// consumesRest reports whether h unpacks all remaining bytes, as it is or ends with a field tagged with rest.
+func consumesRest(h readWriter) bool {
+	switch h := packedBy(h).(type) {
+	case *restReadWriter:
+		return true
+	case *variableStructReadWriter:
+		return h.rest
+	default:
+		return false
+	}
+}
+
+// rejectRest returns an error if the elements of collection type t would be packed by h, which unpacks all remaining
+// bytes, leaving nothing for the elements after it.
+// If h is a struct that is still being scanned, t is checked once that scan completes.
+func rejectRest(t reflect.Type, h readWriter) error {
+	if wrapper, ok := packedBy(h).(*structWrapper); ok {
+		if wrapper.deferRest(t) {
+			return nil
+		}
+		h = wrapper.r
+	}
+	if consumesRest(h) {
+		return restInCollectionError(t)
+	}
+	return nil
+}
+
+func restInCollectionError(t reflect.Type) error {
+	return &UnsupportedTypeError{Type: t, Hint: "rest can only be used at the end of a struct, not within collections"}
+}
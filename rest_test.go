@@ -0,0 +1,108 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRest(t *testing.T) {
+	type envelope struct {
+		Kind    uint8
+		Payload []byte `ikea:"rest"`
+	}
+	type outer struct {
+		ID    uint16
+		Inner envelope
+	}
+
+	value := &outer{ID: 1, Inner: envelope{Kind: 2, Payload: bytes.Repeat([]byte{3}, 1000)}}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := append([]byte{0, 1, 2}, value.Inner.Payload...)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestRest, expected %x, got %x", expected, data)
+	}
+	if l, err := Len(value); err != nil || l != len(data) {
+		t.Errorf("Failing TestRest, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(outer)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestRest, expected %+v, got %+v", value, result)
+	}
+
+	// The payload may end exactly at the MaxBytes limit, but not go beyond it
+	if err := Unmarshal(data, result, MaxBytes(int64(len(data)))); err != nil {
+		t.Errorf("Failing TestRest, expected the payload to fit MaxBytes, got %v", err)
+	}
+	if err := Unmarshal(data, result, MaxBytes(int64(len(data)-1))); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Failing TestRest, expected ErrMessageTooLarge, got %v", err)
+	}
+	if err := Unmarshal(data, result, MaxSliceLength(10)); !errors.Is(err, ErrSliceTooLong) {
+		t.Errorf("Failing TestRest, expected ErrSliceTooLong, got %v", err)
+	}
+
+	text := &struct {
+		Name string `ikea:"rest"`
+	}{}
+	if err := Unmarshal([]byte("héllo"), text); err != nil || text.Name != "héllo" {
+		t.Errorf("Failing TestRest, expected héllo, got %q (%v)", text.Name, err)
+	}
+}
+
+func TestInvalidRest(t *testing.T) {
+	type envelope struct {
+		Payload []byte `ikea:"rest"`
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		Payload []byte `ikea:"rest"`
+		ID      uint8
+	}{})); !errors.As(err, &te) || te.Field != "Payload" {
+		t.Errorf("Failing TestInvalidRest, expected rest before another field to be rejected, got %v", err)
+	}
+	if err := Check(reflect.TypeOf(struct {
+		Inner *envelope
+		ID    uint8
+	}{})); !errors.As(err, &te) || te.Field != "Inner" {
+		t.Errorf("Failing TestInvalidRest, expected a nested rest before another field to be rejected, got %v", err)
+	}
+
+	type recursive struct {
+		Kids []recursive
+		Tail []byte `ikea:"rest"`
+	}
+	type recursiveMap struct {
+		Kids map[uint8]*recursiveMap
+		Tail []byte `ikea:"rest"`
+	}
+
+	for _, v := range []interface{}{
+		recursive{},
+		[]recursive{},
+		recursiveMap{},
+		[]envelope{},
+		[2]envelope{},
+		map[uint8]envelope{},
+		struct {
+			A uint32 `ikea:"rest"`
+		}{},
+		struct {
+			A []byte `ikea:"rest,cstring"`
+		}{},
+	} {
+		if err := Check(reflect.TypeOf(v)); err == nil {
+			t.Errorf("Failing TestInvalidRest, expected %T to be rejected", v)
+		}
+	}
+}
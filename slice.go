@@ -1,73 +1,123 @@
 package ikea
 
 import (
-	"encoding/binary"
 	"fmt"
-	"io"
 	"math"
 	"reflect"
 	"sync"
+	"unsafe"
 )
 
 var (
-	sliceIndex     = make(map[string]*sliceReadWriter)
+	sliceIndex     = make(map[handlerKey]readWriter)
 	sliceIndexLock sync.RWMutex
 )
 
-func getSliceHandlerFromType(t reflect.Type) readWriter {
+func getSliceHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	key := handlerKey{t, cfg}
 	sliceIndexLock.RLock()
-	infoV, found := sliceIndex[t.String()]
+	infoV, found := sliceIndex[key]
 	sliceIndexLock.RUnlock()
 	if found {
-		return infoV
+		return infoV, nil
 	}
 
-	info := &sliceReadWriter{typ: t, handler: getTypeHandler(t.Elem())}
-	sliceIndexLock.Lock()
-	sliceIndex[t.String()] = info
-	sliceIndexLock.Unlock()
+	elemCfg := cfg.elem()
+	if t.Elem().Kind() == reflect.Uint8 {
+		elemCfg.xdr = false // Byte slices are XDR opaque data, of which the bytes are not widened
+	}
+	h, err := getTypeHandler(t.Elem(), elemCfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectRest(t, h); err != nil {
+		return nil, err
+	}
+
+	policy := cfg.nilPolicy(t)
+	var info readWriter = &sliceReadWriter{typ: t, handler: h, rejectNil: policy == NilError, prefix: cfg.prefix()}
+	if policy == NilPresence {
+		info = &presenceReadWriter{typ: t, handler: info, size: cfg.presenceSize()}
+	}
+
+	if !isPlaceholder(h) {
+		sliceIndexLock.Lock()
+		sliceIndex[key] = info
+		sliceIndexLock.Unlock()
+	}
 
-	return info
+	return info, nil
 }
 
 var _ variableReadWriter = (*sliceReadWriter)(nil)
 
 type sliceReadWriter struct {
 	variable
-	typ     reflect.Type
-	handler readWriter
+	typ       reflect.Type
+	handler   readWriter
+	rejectNil bool
+	prefix    lengthPrefix
 }
 
-func (s *sliceReadWriter) readVariable(r io.Reader, v reflect.Value) error {
-	b := make([]byte, 4)
-	if _, err := io.ReadFull(r, b); err != nil {
+func (s *sliceReadWriter) readVariable(r *reader, v reflect.Value) error {
+	l, err := r.readLength(s.prefix, "slice size", r.opts.maxSliceLength, ErrSliceTooLong)
+	if err != nil {
 		return err
 	}
 
-	ul := binary.BigEndian.Uint32(b)
-	if ul > math.MaxInt32 {
-		return fmt.Errorf("transmitted slice size too large (%d>%d)", ul, math.MaxInt32)
-	}
-	l := int(ul)
+	return s.readElements(r, v, l)
+}
 
-	slice := reflect.MakeSlice(s.typ, l, l)
+// readElements reads l elements into v, without a length prefix.
+func (s *sliceReadWriter) readElements(r *reader, v reflect.Value, l int) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.leave()
 
+	var slice reflect.Value
 	if s.handler.isFixed() {
 		hr := s.handler.(fixedReadWriter)
-		sb := make([]byte, l*hr.length())
-		if _, err := io.ReadFull(r, sb); err != nil {
+		if size := hr.length(); size > 0 {
+			if r.limit > 0 && int64(l) > (r.limit-r.n)/int64(size) {
+				return r.limitErr
+			}
+			if l > math.MaxInt32/size {
+				return fmt.Errorf("transmitted slice size too large (%d elements of %d bytes)", l, size)
+			}
+		}
+		// Read before allocating the slice, so the MaxBytes limit is verified first
+		sb, err := r.next(l * hr.length())
+		if err != nil {
 			return err
 		}
 
+		slice = reflect.MakeSlice(s.typ, l, l)
+		if _, raw := hr.(*rawReadWriter); raw {
+			copy(rawBytes(unsafe.Pointer(slice.Pointer()), len(sb)), sb)
+			v.Set(slice)
+			return nil
+		}
+
+		start := r.n - int64(len(sb))
 		for i := 0; i < l; i++ {
 			idx := i * hr.length()
-			hr.readFixed(sb[idx:idx+hr.length()], slice.Index(i))
+			if err := hr.readFixed(sb[idx:idx+hr.length()], slice.Index(i)); err != nil {
+				return offsetFieldError(wrapIndexError(err, i, s.typ.Elem(), 0), start+int64(idx))
+			}
 		}
 	} else {
+		c := r.capacity(l)
+		slice = reflect.MakeSlice(s.typ, c, c)
 		hr := s.handler.(variableReadWriter)
 		for i := 0; i < l; i++ {
+			if i == slice.Len() {
+				slice = reflect.Append(slice, reflect.Zero(s.typ.Elem()))
+			}
+
+			start := r.n
 			if err := hr.readVariable(r, slice.Index(i)); err != nil {
-				return err
+				return wrapIndexError(err, i, s.typ.Elem(), start)
 			}
 		}
 	}
@@ -76,21 +126,34 @@ func (s *sliceReadWriter) readVariable(r io.Reader, v reflect.Value) error {
 	return nil
 }
 
-func (s *sliceReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(v.Len()))
+func (s *sliceReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if s.rejectNil && v.IsNil() {
+		return &NilValueError{Type: s.typ}
+	}
 
-	if _, err := w.Write(b); err != nil {
+	if err := w.writeLength(s.prefix, v.Len()); err != nil {
 		return err
 	}
 
+	return s.writeElements(w, v)
+}
+
+// writeElements writes the elements of v, without a length prefix.
+func (s *sliceReadWriter) writeElements(w *writer, v reflect.Value) error {
 	if s.handler.isFixed() {
 		hw := s.handler.(fixedReadWriter)
-		sb := make([]byte, v.Len()*hw.length())
-
-		for i := 0; i < v.Len(); i++ {
-			idx := i * hw.length()
-			hw.writeFixed(sb[idx:idx+hw.length()], v.Index(i))
+		sb := w.scratch(v.Len() * hw.length())
+
+		if _, raw := hw.(*rawReadWriter); raw {
+			// The memory of the elements is equal to their packed form, so copy it all at once
+			copy(sb, rawBytes(unsafe.Pointer(v.Pointer()), len(sb)))
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				idx := i * hw.length()
+				if err := hw.writeFixed(sb[idx:idx+hw.length()], v.Index(i)); err != nil {
+					return offsetFieldError(wrapIndexError(err, i, s.typ.Elem(), 0), w.n+int64(idx))
+				}
+			}
 		}
 
 		if _, err := w.Write(sb); err != nil {
@@ -99,8 +162,9 @@ func (s *sliceReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
 	} else {
 		hw := s.handler.(variableReadWriter)
 		for i := 0; i < v.Len(); i++ {
+			start := w.n
 			if err := hw.writeVariable(w, v.Index(i)); err != nil {
-				return err
+				return wrapIndexError(err, i, s.typ.Elem(), start)
 			}
 		}
 	}
@@ -108,17 +172,35 @@ func (s *sliceReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
 	return nil
 }
 
-func (s *sliceReadWriter) vLength(v reflect.Value) int {
+func (s *sliceReadWriter) vLength(v reflect.Value) (int, error) {
+	if s.rejectNil && v.IsNil() {
+		return 0, &NilValueError{Type: s.typ}
+	}
+
+	size, err := s.prefix.bytes(v.Len())
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := s.elementsLength(v)
+	return size + l, err
+}
+
+// elementsLength returns the packed size of the elements of v, without a length prefix.
+func (s *sliceReadWriter) elementsLength(v reflect.Value) (int, error) {
 	if s.handler.isFixed() {
-		return 4 + (v.Len() * s.handler.(fixedReadWriter).length())
+		return v.Len() * s.handler.(fixedReadWriter).length(), nil
 	}
 
 	// variable
-	size := 4
+	size := 0
 	h := s.handler.(variableReadWriter)
 	for i := 0; i < v.Len(); i++ {
-		l := h.vLength(v.Index(i))
+		l, err := h.vLength(v.Index(i))
+		if err != nil {
+			return 0, wrapIndexError(err, i, s.typ.Elem(), -1)
+		}
 		size += l
 	}
-	return size
+	return size, nil
 }
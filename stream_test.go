@@ -0,0 +1,62 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(source); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if enc.Offset() != int64(buf.Len()) {
+		t.Errorf("Failing TestEncoderDecoder, encoder offset %d does not match written bytes %d", enc.Offset(), buf.Len())
+	}
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	for i := 0; i < 3; i++ {
+		tst := new(testStruct)
+		if err := dec.Decode(tst); err != nil {
+			t.Error(err)
+			return
+		}
+		compare(t, "TestString", tst.TestString, source.TestString)
+	}
+	if dec.Offset() != int64(buf.Len()) {
+		t.Errorf("Failing TestEncoderDecoder, decoder offset %d does not match read bytes %d", dec.Offset(), buf.Len())
+	}
+
+	if err := dec.Decode(new(testStruct)); err != io.EOF {
+		t.Errorf("Failing TestEncoderDecoder, decoding past the last message should return io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	data, err := Marshal(source)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Cut off right after the 4 bytes length prefix of TestString, so the next read returns no bytes at all
+	dec := NewDecoder(bytes.NewReader(data[:48]))
+	if err := dec.Decode(new(testStruct)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Failing TestDecoderUnexpectedEOF, truncated message should return io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	dec.Reset(bytes.NewReader(data))
+	if dec.Offset() != 0 {
+		t.Errorf("Failing TestDecoderUnexpectedEOF, offset was not reset")
+	}
+	if err := dec.Decode(new(testStruct)); err != nil {
+		t.Errorf("Failing TestDecoderUnexpectedEOF, could not decode after reset: %s", err.Error())
+	}
+}
@@ -1,37 +1,30 @@
 package ikea
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"reflect"
+	"strings"
 	"unicode/utf8"
 )
 
-var stringTypeHandler = new(stringReadWriter)
-
 var _ variableReadWriter = (*stringReadWriter)(nil)
 
 type stringReadWriter struct {
 	variable
+	prefix lengthPrefix
 }
 
-func (s *stringReadWriter) readVariable(r io.Reader, v reflect.Value) error {
-	b := make([]byte, 4)
-	if _, err := io.ReadFull(r, b); err != nil {
+func (s *stringReadWriter) readVariable(r *reader, v reflect.Value) error {
+	l, err := r.readLength(s.prefix, "string size", r.opts.maxStringLength, ErrStringTooLong)
+	if err != nil {
 		return err
 	}
 
-	ul := binary.BigEndian.Uint32(b)
-	if ul > math.MaxInt32 {
-		return fmt.Errorf("transmitted string size too large (%d>%d)", ul, math.MaxInt32)
-	}
-	l := int(ul)
-
-	str := make([]byte, l)
-	if _, err := io.ReadFull(r, str); err != nil {
+	str, err := r.next(l)
+	if err != nil {
 		return err
 	}
 
@@ -43,20 +36,157 @@ func (s *stringReadWriter) readVariable(r io.Reader, v reflect.Value) error {
 	return nil
 }
 
-func (s *stringReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(v.Len()))
+func (s *stringReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if err := w.writeLength(s.prefix, v.Len()); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, v.String()); err != nil {
+		return err
+	}
 
-	if _, err := w.Write(b); err != nil {
+	return nil
+}
+
+func (s *stringReadWriter) vLength(v reflect.Value) (int, error) {
+	size, err := s.prefix.bytes(v.Len())
+	return size + v.Len(), err
+}
+
+// getByteStringHandler returns a handler for string and []byte fields tagged with fixed:N, cstring or rest, or nil if
+// none of them apply.
+func getByteStringHandler(t reflect.Type, cfg config) readWriter {
+	if !isByteString(t) {
+		return nil
+	}
+	str := t.Kind() == reflect.String
+
+	if cfg.local.fixedSize > 0 {
+		return &fixedStringReadWriter{size: cfg.local.fixedSize, pad: cfg.opaquePadding(cfg.local.fixedSize), str: str}
+	}
+	if cfg.local.cstring {
+		return &cstringReadWriter{str: str}
+	}
+	if cfg.local.rest {
+		return &restReadWriter{str: str}
+	}
+	return nil
+}
+
+var _ fixedReadWriter = (*fixedStringReadWriter)(nil)
+
+// fixedStringReadWriter packs strings and byte slices in exactly size bytes, padded with zeroes.
+// The padding is stripped when unpacking, so trailing zeroes of the value itself are lost.
+// In XDR mode, the size is followed by pad zero bytes.
+type fixedStringReadWriter struct {
+	fixed
+	size int
+	pad  int
+	str  bool
+}
+
+func (s *fixedStringReadWriter) length() int {
+	return s.size + s.pad
+}
+
+func (s *fixedStringReadWriter) readFixed(b []byte, v reflect.Value) error {
+	b = bytes.TrimRight(b[:s.size], "\x00")
+	return setByteString(v, b, s.str)
+}
+
+func (s *fixedStringReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	if v.Len() > s.size {
+		return fmt.Errorf("%w: %d bytes do not fit in fixed size %d", ErrOverflow, v.Len(), s.size)
+	}
+
+	if s.str {
+		copy(b, v.String())
+	} else {
+		copy(b, v.Bytes())
+	}
+	return nil
+}
+
+var _ variableReadWriter = (*cstringReadWriter)(nil)
+
+// cstringReadWriter packs strings and byte slices followed by a NUL byte, rather than prefixed by their length.
+type cstringReadWriter struct {
+	variable
+	str bool
+}
+
+func (s *cstringReadWriter) readVariable(r *reader, v reflect.Value) error {
+	max, limitErr := r.opts.maxSliceLength, ErrSliceTooLong
+	if s.str {
+		max, limitErr = r.opts.maxStringLength, ErrStringTooLong
+	}
+
+	var buf []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c == 0 {
+			break
+		}
+		if max > 0 && len(buf) >= max {
+			return fmt.Errorf("%w (>%d)", limitErr, max)
+		}
+		buf = append(buf, c)
+	}
+
+	return setByteString(v, buf, s.str)
+}
+
+func (s *cstringReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	if err := s.check(v); err != nil {
 		return err
 	}
-	if _, err := w.Write([]byte(v.String())); err != nil {
+
+	var b []byte
+	if s.str {
+		b = []byte(v.String())
+	} else {
+		b = v.Bytes()
+	}
+	if _, err := w.Write(b); err != nil {
 		return err
 	}
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+func (s *cstringReadWriter) vLength(v reflect.Value) (int, error) {
+	if err := s.check(v); err != nil {
+		return 0, err
+	}
+	return v.Len() + 1, nil
+}
 
+// check returns an error if v contains a NUL byte, as that would end it early when unpacking.
+func (s *cstringReadWriter) check(v reflect.Value) error {
+	var i int
+	if s.str {
+		i = strings.IndexByte(v.String(), 0)
+	} else {
+		i = bytes.IndexByte(v.Bytes(), 0)
+	}
+	if i != -1 {
+		return errors.New("cstring contains a NUL byte")
+	}
 	return nil
 }
 
-func (s *stringReadWriter) vLength(v reflect.Value) int {
-	return 4 + v.Len()
+// setByteString sets string or byte slice v to a copy of b.
+func setByteString(v reflect.Value, b []byte, str bool) error {
+	if !str {
+		v.SetBytes(append(make([]byte, 0, len(b)), b...))
+		return nil
+	}
+
+	if !utf8.Valid(b) {
+		return errors.New("invalid utf8 string")
+	}
+	v.SetString(string(b))
+	return nil
 }
@@ -0,0 +1,96 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFixedString(t *testing.T) {
+	type record struct {
+		Tag string `ikea:"fixed:8"`
+		Key []byte `ikea:"fixed:4"`
+		ID  uint16
+	}
+
+	h, err := getTypeHandler(reflect.TypeOf(record{}), config{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !h.isFixed() || h.(fixedReadWriter).length() != 14 {
+		t.Errorf("Failing TestFixedString, expected a fixed handler of 14 bytes, got %T", h)
+	}
+
+	value := &record{Tag: "héllo", Key: []byte{1, 2}, ID: 3}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := append([]byte("héllo"), 0, 0, 1, 2, 0, 0, 0, 3)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestFixedString, expected %x, got %x", expected, data)
+	}
+
+	result := new(record)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestFixedString, expected %+v, got %+v", value, result)
+	}
+
+	var fe *FieldError
+	if _, err := Marshal(&record{Tag: "too long!"}); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Path != "record.Tag" {
+		t.Errorf("Failing TestFixedString, expected Tag to overflow, got %v", err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		A []uint16 `ikea:"fixed:4"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestFixedString, expected fixed on []uint16 to be rejected, got %v", err)
+	}
+}
+
+func TestCString(t *testing.T) {
+	type record struct {
+		Name string `ikea:"cstring"`
+		Data []byte `ikea:"cstring"`
+	}
+
+	value := &record{Name: "name", Data: []byte{1, 2}}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte{'n', 'a', 'm', 'e', 0, 1, 2, 0}) {
+		t.Errorf("Failing TestCString, unexpected output %x", data)
+	}
+	if l, err := Len(value); err != nil || l != len(data) {
+		t.Errorf("Failing TestCString, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(record)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestCString, expected %+v, got %+v", value, result)
+	}
+
+	if _, err := Marshal(&record{Name: "a\x00b"}); err == nil {
+		t.Error("Failing TestCString, a string containing NUL should not be packed")
+	}
+	if _, err := Len(&record{Data: []byte{1, 0}}); err == nil {
+		t.Error("Failing TestCString, Len should reject a byte slice containing NUL like packing does")
+	}
+	if err := Unmarshal(data, new(record), MaxStringLength(3)); !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("Failing TestCString, expected the string limit to apply, got %v", err)
+	}
+}
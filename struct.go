@@ -1,26 +1,27 @@
 package ikea
 
 import (
-	"compress/flate"
-	"io"
+	"fmt"
 	"reflect"
-	"strconv"
-	"strings"
 	"sync"
 	"unicode"
 )
 
 var (
-	structIndex     = make(map[string]readWriter)
+	structIndex     = make(map[handlerKey]readWriter)
 	structIndexLock sync.RWMutex
 )
 
-func getStructHandlerFromType(t reflect.Type) readWriter {
+func getStructHandlerFromType(t reflect.Type, cfg config) (readWriter, error) {
+	key := handlerKey{t, cfg}
 	structIndexLock.RLock()
-	infoV, found := structIndex[t.String()]
+	infoV, found := structIndex[key]
 	structIndexLock.RUnlock()
 	if found {
-		return infoV
+		if wrapper, ok := infoV.(*structWrapper); ok && wrapper.err != nil {
+			return nil, wrapper.err
+		}
+		return infoV, nil
 	}
 
 	ret := new(structWrapper)
@@ -29,7 +30,7 @@ func getStructHandlerFromType(t reflect.Type) readWriter {
 
 	// For now, insert the wrapper, so recursive struct calls won't cause an infinite stack
 	structIndexLock.Lock()
-	structIndex[t.String()] = ret
+	structIndex[key] = ret
 	structIndexLock.Unlock()
 
 	interfaceTest := reflect.New(t).Type()
@@ -38,31 +39,47 @@ func getStructHandlerFromType(t reflect.Type) readWriter {
 		hasPacker   = interfaceTest.Implements(packerInterface)
 	)
 	if hasUnpacker && hasPacker {
-		ret.r = &customReadWriter{fallback: nil}
-	} else if hasUnpacker || hasPacker {
-		ret.r = &customReadWriter{fallback: scanStruct(t)}
+		ret.r = &customReadWriter{fallback: nil, opts: cfg.options()}
 	} else {
-		ret.r = scanStruct(t)
+		scanned, err := scanStruct(t, cfg)
+		if err != nil {
+			// Keep the wrapper in the index, any handler that already refers to it will now return this error
+			ret.err = err
+			return nil, err
+		}
+
+		if hasUnpacker || hasPacker {
+			ret.r = &customReadWriter{fallback: scanned, opts: cfg.options()}
+		} else {
+			ret.r = scanned
+		}
+	}
+
+	// Recursive collections of this struct could not tell whether it ends with rest while it was being scanned
+	if collections := ret.scanned(); len(collections) > 0 && consumesRest(ret.r) {
+		ret.err = restInCollectionError(collections[0])
+		return nil, ret.err
 	}
 
 	// Replace the original with the direct version (major performance boost)
 	structIndexLock.Lock()
-	structIndex[t.String()] = ret.r
+	structIndex[key] = ret.r
 	structIndexLock.Unlock()
 
-	return ret.r
+	return ret.r, nil
 }
 
-func scanStruct(t reflect.Type) readWriter {
-	handlers := make([]readWriter, 0)
+func scanStruct(t reflect.Type, cfg config) (readWriter, error) {
+	fields := make([]structField, 0, t.NumField())
+	var group *bitGroupReadWriter
 
+	var restField, restTag string // The field that unpacks all remaining bytes, which has to be the last one
 	length := 0
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
 		r := rune(field.Name[0])
-		if unicode.ToLower(r) == r {
-			handlers = append(handlers, nil)
+		if unicode.ToLower(r) == r && field.Name != "_" {
 			continue // Ignore, unexported
 		}
 
@@ -72,40 +89,183 @@ func scanStruct(t reflect.Type) readWriter {
 		}
 
 		if tag == "-" {
-			handlers = append(handlers, nil)
 			continue // Ignore, ignored
 		}
 
-		h := getTypeHandler(field.Type)
+		ft, err := parseFieldTag(tag, field.Type)
+		if err != nil {
+			return nil, &InvalidTagError{Type: t, Field: field.Name, Tag: tag, Err: err}
+		}
+		if field.Name == "_" && !ft.blank() {
+			continue // Ignore, blank fields are only packed for options like const and pad
+		}
+		if restField != "" {
+			err = fmt.Errorf("rest can only be used on the last field, but it is followed by %s", field.Name)
+			return nil, &InvalidTagError{Type: t, Field: restField, Tag: restTag, Err: err}
+		}
+
+		// Consecutive bit fields are packed together by a single handler
+		if ft.bits > 0 {
+			if group == nil {
+				group = new(bitGroupReadWriter)
+				fields = append(fields, structField{index: -1, name: field.Name, typ: t, handler: group})
+			}
+			group.add(bitField{index: i, name: field.Name, typ: field.Type, bits: ft.bits})
+			continue
+		}
+		group = nil
+
+		fieldCfg := ft.config(cfg)
+		var (
+			h   readWriter
+			ref *lengthRef
+		)
+		if field.Name == "_" && !ft.constant.IsValid() {
+			h = blankReadWriter{} // Only there for its padding
+		} else if ft.lengthField != "" {
+			var counter int
+			if counter, err = findCounter(fields, ft.lengthField); err != nil {
+				return nil, &InvalidTagError{Type: t, Field: field.Name, Tag: tag, Err: err}
+			}
+			ref = &lengthRef{counter: counter, counted: len(fields), bytes: ft.lengthBytes}
+			fields[counter].length = ref
+
+			h, err = getCountedHandler(field.Type, fieldCfg, ft.lengthBytes)
+		} else {
+			h, err = getTypeHandler(field.Type, fieldCfg)
+		}
+		if err != nil {
+			return nil, withField(err, field.Name)
+		}
+
+		if ft.constant.IsValid() {
+			if !h.isFixed() {
+				return nil, &InvalidTagError{Type: t, Field: field.Name, Tag: tag, Err: fmt.Errorf("const can only be used on fixed size fields")}
+			}
+			h = &constReadWriter{fixedReadWriter: h.(fixedReadWriter), value: ft.constant}
+		}
+
 		if h.isFixed() && length != -1 {
 			length += h.(fixedReadWriter).length()
 		} else {
 			length = -1
 		}
 
-		if strings.HasPrefix(tag, "compress") {
+		if ft.cond != nil {
+			if err = ft.cond.resolve(conditionLookup(fields)); err != nil {
+				return nil, &InvalidTagError{Type: t, Field: field.Name, Tag: tag, Err: err}
+			}
+			length = -1 // Conditional fields may be absent
+		}
+
+		if ft.compress {
 			length = -1
+			h = &compressionReadWriter{handler: h, level: ft.level, maxOut: ft.maxOut, prefix: fieldCfg.prefix(), opts: cfg.options()}
+			h = withOpaquePadding(h, fieldCfg)
+		}
+
+		if consumesRest(h) {
+			restField, restTag = field.Name, tag
+		}
+
+		fields = append(fields, structField{
+			index: i, name: field.Name, typ: field.Type, handler: h, length: ref, cond: ft.cond, pad: ft.pad, align: ft.align,
+		})
+	}
+
+	if length != -1 {
+		// The size of bit groups is only known once all their fields have been added, and alignment depends on the
+		// offset of each field, so the size is calculated once more in order
+		length = 0
+		for _, field := range fields {
+			length += field.padding(length) + field.handler.(fixedReadWriter).length()
+		}
+
+		h := &fixedStructReadWriter{size: length, fields: fields}
+		if cfg.order == NativeEndian && isRawLayout(t, fields, length) {
+			return &rawReadWriter{h}, nil
+		}
+		return h, nil
+	}
 
-			var level = flate.BestCompression
-			if strings.HasPrefix(tag, "compress:") {
-				var err error
-				level, err = strconv.Atoi(strings.TrimPrefix(tag, "compress:"))
-				if err != nil {
-					panic(err)
+	return &variableStructReadWriter{fields: fields, rest: restField != ""}, nil
+}
+
+// structField describes a single packed field of a struct.
+// An index of -1 describes a group of bit fields, of which the handler operates on the struct itself.
+type structField struct {
+	index   int
+	name    string
+	typ     reflect.Type
+	handler readWriter
+	length  *lengthRef // Set on both fields if this field holds the length of another, or the other way around
+	cond    *condition // If set, the field is only packed if the condition holds
+	pad     int        // Amount of zero bytes packed in front of the field
+	align   int        // If set, zero bytes are packed in front of the field until its offset is a multiple of align
+}
+
+// conditionLookup returns a function that looks up the fields conditions can refer to, which are the integer and
+// bool fields packed before the current one.
+func conditionLookup(fields []structField) func(string) (fieldRef, bool) {
+	return func(name string) (fieldRef, bool) {
+		for pos, field := range fields {
+			if group, ok := field.handler.(*bitGroupReadWriter); ok && field.index < 0 {
+				for _, bf := range group.fields {
+					if bf.name == name {
+						return fieldRef{index: bf.index, pos: -1}, true
+					}
 				}
+			} else if field.name == name && (field.typ.Kind() == reflect.Bool || isInteger(field.typ.Kind())) {
+				return fieldRef{index: field.index, pos: pos}, true
 			}
+		}
+		return fieldRef{}, false
+	}
+}
 
-			h = &compressionReadWriter{handler: h, level: level}
+// findCounter returns the position of the field called name within fields, which has to be able to hold a length.
+func findCounter(fields []structField, name string) (int, error) {
+	for i, field := range fields {
+		if field.index < 0 || field.name != name {
+			continue
 		}
 
-		handlers = append(handlers, h)
+		if !isInteger(field.typ.Kind()) {
+			return 0, fmt.Errorf("length field %s is not an integer", name)
+		}
+		if field.length != nil {
+			return 0, fmt.Errorf("length field %s already holds the length of another field", name)
+		}
+		if field.cond != nil {
+			return 0, fmt.Errorf("length field %s can not be conditional", name)
+		}
+		return i, nil
 	}
 
-	if length != -1 {
-		return &fixedStructReadWriter{size: length, handlers: handlers}
+	return 0, fmt.Errorf("length field %s is not an earlier packed field", name)
+}
+
+// value returns the value of the field within struct v.
+func (f *structField) value(v reflect.Value) reflect.Value {
+	if f.index < 0 {
+		return v
 	}
+	return v.Field(f.index)
+}
 
-	return &variableStructReadWriter{handlers: handlers}
+// wrap wraps err in a FieldError for this field, the errors of bit groups already name the field they belong to.
+func (f *structField) wrap(err error, offset int64) error {
+	if f.index < 0 {
+		return err
+	}
+	return wrapFieldError(withField(err, f.name), f.name, f.typ, offset)
+}
+
+// isPlaceholder reports whether h is a struct that is still being scanned, handlers referring to it should not be
+// cached, as the scan may still fail.
+func isPlaceholder(h readWriter) bool {
+	_, ok := h.(*structWrapper)
+	return ok
 }
 
 var _ variableReadWriter = (*structWrapper)(nil)
@@ -113,19 +273,53 @@ var _ variableReadWriter = (*structWrapper)(nil)
 type structWrapper struct {
 	sync.Mutex
 	variable
-	r readWriter
+	r   readWriter
+	err error
+
+	// Collections of the struct found while it was still being scanned, guarded by structIndexLock
+	collections []reflect.Type
+	done        bool
 }
 
-func (s *structWrapper) vLength(v reflect.Value) int {
-	return s.r.(variableReadWriter).vLength(v)
+// deferRest records collection type t to be checked for rest once the struct has been scanned, it returns false if
+// that already happened, after which r is set.
+func (s *structWrapper) deferRest(t reflect.Type) bool {
+	structIndexLock.Lock()
+	defer structIndexLock.Unlock()
+	if s.done {
+		return false
+	}
+	s.collections = append(s.collections, t)
+	return true
 }
 
-func (s *structWrapper) readVariable(r io.Reader, v reflect.Value) error {
-	return s.r.(variableReadWriter).readVariable(r, v)
+// scanned marks the scan of the struct as completed, and returns the collections recorded by deferRest.
+func (s *structWrapper) scanned() []reflect.Type {
+	structIndexLock.Lock()
+	defer structIndexLock.Unlock()
+	s.done = true
+	return s.collections
 }
 
-func (s *structWrapper) writeVariable(w io.Writer, v reflect.Value) error {
-	return s.r.(variableReadWriter).writeVariable(w, v)
+func (s *structWrapper) vLength(v reflect.Value) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return handleVariableLength(s.r, v)
+}
+
+func (s *structWrapper) readVariable(r *reader, v reflect.Value) error {
+	if s.err != nil {
+		return s.err
+	}
+	return handleVariableReader(r, s.r, v)
+}
+
+func (s *structWrapper) writeVariable(w *writer, v reflect.Value) error {
+	if s.err != nil {
+		return s.err
+	}
+	return handleVariableWriter(w, s.r, v)
 }
 
 var _ fixedReadWriter = (*fixedStructReadWriter)(nil)
@@ -133,36 +327,43 @@ var _ fixedReadWriter = (*fixedStructReadWriter)(nil)
 type fixedStructReadWriter struct {
 	fixed
 
-	size     int
-	handlers []readWriter
+	size   int
+	fields []structField
 }
 
 func (s *fixedStructReadWriter) length() int {
 	return s.size
 }
 
-func (s *fixedStructReadWriter) readFixed(data []byte, v reflect.Value) {
+func (s *fixedStructReadWriter) readFixed(data []byte, v reflect.Value) error {
 	read := 0
-	for i, handler := range s.handlers {
-		if handler == nil {
-			continue
+	for _, field := range s.fields {
+		read += field.padding(read)
+		r := field.handler.(fixedReadWriter)
+		if err := r.readFixed(data[read:read+r.length()], field.value(v)); err != nil {
+			return offsetFieldError(field.wrap(err, 0), int64(read))
 		}
-		r := handler.(fixedReadWriter)
-		r.readFixed(data[read:read+r.length()], v.Field(i))
 		read += r.length()
 	}
+
+	return nil
 }
 
-func (s *fixedStructReadWriter) writeFixed(data []byte, v reflect.Value) {
+func (s *fixedStructReadWriter) writeFixed(data []byte, v reflect.Value) error {
 	written := 0
-	for i, handler := range s.handlers {
-		if handler == nil {
-			continue
+	for _, field := range s.fields {
+		for pad := field.padding(written); pad > 0; pad-- {
+			data[written] = 0
+			written++
+		}
+		w := field.handler.(fixedReadWriter)
+		if err := w.writeFixed(data[written:written+w.length()], field.value(v)); err != nil {
+			return offsetFieldError(field.wrap(err, 0), int64(written))
 		}
-		w := handler.(fixedReadWriter)
-		w.writeFixed(data[written:written+w.length()], v.Field(i))
 		written += w.length()
 	}
+
+	return nil
 }
 
 var _ variableReadWriter = (*variableStructReadWriter)(nil)
@@ -170,44 +371,116 @@ var _ variableReadWriter = (*variableStructReadWriter)(nil)
 type variableStructReadWriter struct {
 	variable
 
-	handlers []readWriter
+	fields []structField
+	rest   bool // The last field unpacks all remaining bytes
 }
 
-func (h *variableStructReadWriter) readVariable(r io.Reader, v reflect.Value) error {
-	for i, handler := range h.handlers {
-		if handler == nil {
+func (h *variableStructReadWriter) readVariable(r *reader, v reflect.Value) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	structStart := r.n
+	for i, field := range h.fields {
+		if field.cond != nil && !h.present(i, v, false) {
+			field.value(v).Set(reflect.Zero(field.typ))
 			continue
 		}
-		if err := handleVariableReader(r, handler, v.Field(i)); err != nil {
-			return err
+
+		if pad := field.padding(int(r.n - structStart)); pad > 0 {
+			if _, err := r.next(pad); err != nil {
+				return field.wrap(err, r.n)
+			}
+		}
+
+		start := r.n
+		var err error
+		if field.length != nil && field.length.counted == i {
+			// The counter has been read already, as it has to precede this field
+			var l int
+			if l, err = counterValue(h.fields[field.length.counter].value(v)); err == nil {
+				err = field.handler.(*countedReadWriter).readCounted(r, field.value(v), l)
+			}
+		} else {
+			err = handleVariableReader(r, field.handler, field.value(v))
+		}
+		if err != nil {
+			return field.wrap(err, start)
 		}
 	}
 
 	return nil
 }
 
-func (h *variableStructReadWriter) writeVariable(w io.Writer, v reflect.Value) error {
-	for i, handler := range h.handlers {
-		if handler == nil {
+func (h *variableStructReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	structStart := w.n
+	for i, field := range h.fields {
+		if field.cond != nil && !h.present(i, v, true) {
 			continue
 		}
-		if err := handleVariableWriter(w, handler, v.Field(i)); err != nil {
-			return err
+
+		if pad := field.padding(int(w.n - structStart)); pad > 0 {
+			if _, err := w.Write(w.scratch(pad)); err != nil {
+				return field.wrap(err, w.n)
+			}
+		}
+
+		start := w.n
+		fv, err := h.value(i, v)
+		if err == nil {
+			err = handleVariableWriter(w, field.handler, fv)
+		}
+		if err != nil {
+			return field.wrap(err, start)
 		}
 	}
 
 	return nil
 }
 
-func (h *variableStructReadWriter) vLength(v reflect.Value) int {
+// value returns the value to pack for the field at position i of struct v, which differs from the field itself for
+// fields holding the length of another field.
+func (h *variableStructReadWriter) value(i int, v reflect.Value) (reflect.Value, error) {
+	field := &h.fields[i]
+	if field.length == nil || field.length.counter != i {
+		return field.value(v), nil
+	}
+	return counterFor(field.value(v), &h.fields[field.length.counted], v)
+}
+
+// present evaluates the condition of the field at position i of struct v. When packing, fields holding the length of
+// another field are evaluated as they will be packed.
+func (h *variableStructReadWriter) present(i int, v reflect.Value, packing bool) bool {
+	return h.fields[i].cond.eval(func(ref fieldRef) reflect.Value {
+		if packing && ref.pos >= 0 {
+			if fv, err := h.value(ref.pos, v); err == nil {
+				return fv
+			}
+		}
+		return v.Field(ref.index)
+	}) != 0
+}
+
+func (h *variableStructReadWriter) vLength(v reflect.Value) (int, error) {
 	size := 0
 
-	for i, handler := range h.handlers {
-		if handler == nil {
+	for i, field := range h.fields {
+		if field.cond != nil && !h.present(i, v, true) {
 			continue
 		}
-		size += handleVariableLength(handler, v.Field(i))
+
+		fv, err := h.value(i, v)
+		if err != nil {
+			return 0, field.wrap(err, -1)
+		}
+
+		l, err := handleVariableLength(field.handler, fv)
+		if err != nil {
+			return 0, field.wrap(err, -1)
+		}
+		size += field.padding(size) + l
 	}
 
-	return size
+	return size, nil
 }
@@ -0,0 +1,325 @@
+package ikea
+
+import (
+	"compress/flate"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fieldTag holds the parsed options of an ikea struct tag.
+type fieldTag struct {
+	compress  bool
+	level     int
+	maxOut    int64
+	nilPolicy NilPolicy
+	sorted    bool
+	timeUnit  time.Duration
+	timeZone  bool
+	text      bool
+	intSize   int
+	wire      reflect.Kind
+	varint    bool
+	order     Endianness
+	hasOrder  bool
+	bits      int
+	fixedSize int
+	cstring   bool
+	rest      bool
+	lengths   lengthSize
+	// lengthField names the field holding the length of this one, which is a size in bytes if lengthBytes is set
+	lengthField string
+	lengthBytes bool
+	cond        *condition
+	constant    reflect.Value // Valid if the field is a constant
+	pad         int
+	align       int
+}
+
+// parseFieldTag parses a comma separated list of options, each option is either a name or a name:value pair.
+// t is the type of the field, which is used to validate whether the options apply to it.
+func parseFieldTag(tag string, t reflect.Type) (*fieldTag, error) {
+	ft := &fieldTag{level: flate.BestCompression}
+	if tag == "" {
+		return ft, nil
+	}
+
+	for _, option := range strings.Split(tag, ",") {
+		parts := strings.SplitN(option, ":", 2)
+		name, hasValue := parts[0], len(parts) == 2
+
+		switch name {
+		case "compress":
+			ft.compress = true
+			if hasValue {
+				level, err := strconv.Atoi(parts[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid compression level %q", parts[1])
+				}
+				if level < flate.HuffmanOnly || level > flate.BestCompression {
+					return nil, fmt.Errorf("compression level %d out of range [%d,%d]", level, flate.HuffmanOnly, flate.BestCompression)
+				}
+				ft.level = level
+			}
+		case "maxout":
+			if !hasValue {
+				return nil, fmt.Errorf("maxout requires a size")
+			}
+			maxOut, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || maxOut <= 0 {
+				return nil, fmt.Errorf("invalid maxout size %q", parts[1])
+			}
+			ft.maxOut = maxOut
+		case "nil":
+			if !hasValue {
+				return nil, fmt.Errorf("nil requires a policy")
+			}
+			policy, err := parseNilPolicy(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			switch t.Kind() {
+			case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			default:
+				return nil, fmt.Errorf("nil can not be used on type %s", t)
+			}
+			if t.Kind() == reflect.Interface && policy == NilZero {
+				return nil, fmt.Errorf("nil:zero can not be used on interfaces")
+			}
+			ft.nilPolicy = policy
+		case "sorted":
+			if baseType(t).Kind() != reflect.Map {
+				return nil, fmt.Errorf("sorted can only be used on maps, not %s", t)
+			}
+			ft.sorted = true
+		case "time":
+			if !hasValue {
+				return nil, fmt.Errorf("time requires a unit")
+			}
+			if baseType(t) != timeType {
+				return nil, fmt.Errorf("time can only be used on time.Time, not %s", t)
+			}
+			unit, err := parseTimeUnit(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			ft.timeUnit = unit
+		case "zone":
+			if baseType(t) != timeType {
+				return nil, fmt.Errorf("zone can only be used on time.Time, not %s", t)
+			}
+			ft.timeZone = true
+		case "text":
+			if !implementsOwn(baseType(t), textMarshalerInterface, textUnmarshalerInterface) {
+				return nil, fmt.Errorf("text can only be used on types implementing encoding.TextMarshaler and encoding.TextUnmarshaler, not %s", t)
+			}
+			ft.text = true
+		case "int32", "int64":
+			if k := baseType(t).Kind(); k != reflect.Int && k != reflect.Uint {
+				return nil, fmt.Errorf("%s can only be used on int and uint, not %s", name, t)
+			}
+			ft.intSize = 32
+			if name == "int64" {
+				ft.intSize = 64
+			}
+		case "wire":
+			if !hasValue {
+				return nil, fmt.Errorf("wire requires an integer type")
+			}
+			if !isInteger(baseType(t).Kind()) {
+				return nil, fmt.Errorf("wire can only be used on integers, not %s", t)
+			}
+			wire, err := parseWireKind(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			ft.wire = wire
+		case "bits":
+			if !hasValue {
+				return nil, fmt.Errorf("bits requires a size")
+			}
+			bits, err := parseBits(parts[1], t)
+			if err != nil {
+				return nil, err
+			}
+			ft.bits = bits
+		case "fixed":
+			if !hasValue {
+				return nil, fmt.Errorf("fixed requires a size")
+			}
+			if !isByteString(t) {
+				return nil, fmt.Errorf("fixed can only be used on strings and byte slices, not %s", t)
+			}
+			size, err := strconv.Atoi(parts[1])
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid fixed size %q", parts[1])
+			}
+			ft.fixedSize = size
+		case "cstring":
+			if !isByteString(t) {
+				return nil, fmt.Errorf("cstring can only be used on strings and byte slices, not %s", t)
+			}
+			ft.cstring = true
+		case "rest":
+			if !isByteString(t) {
+				return nil, fmt.Errorf("rest can only be used on strings and byte slices, not %s", t)
+			}
+			ft.rest = true
+		case "len":
+			if !hasValue {
+				return nil, fmt.Errorf("len requires a size")
+			}
+			size, err := parseLengthSize(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			ft.lengths = size
+		case "count", "size":
+			if !hasValue || parts[1] == "" {
+				return nil, fmt.Errorf("%s requires a field name", name)
+			}
+			if t.Kind() != reflect.String && t.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("%s can only be used on strings and slices, not %s", name, t)
+			}
+			if ft.lengthField != "" {
+				return nil, fmt.Errorf("count and size can not be combined")
+			}
+			ft.lengthField, ft.lengthBytes = parts[1], name == "size"
+		case "if":
+			if !hasValue {
+				return nil, fmt.Errorf("if requires a condition")
+			}
+			cond, err := parseCondition(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			ft.cond = cond
+		case "const":
+			if !hasValue {
+				return nil, fmt.Errorf("const requires a value")
+			}
+			constant, err := parseConst(parts[1], t)
+			if err != nil {
+				return nil, err
+			}
+			ft.constant = constant
+		case "pad", "align":
+			if !hasValue {
+				return nil, fmt.Errorf("%s requires a size", name)
+			}
+			n, err := parsePadding(name, parts[1])
+			if err != nil {
+				return nil, err
+			}
+			if name == "pad" {
+				ft.pad = n
+			} else {
+				ft.align = n
+			}
+		case "le":
+			ft.order, ft.hasOrder = LittleEndian, true
+		case "be":
+			ft.order, ft.hasOrder = BigEndian, true
+		case "varint":
+			if !isInteger(baseType(t).Kind()) {
+				return nil, fmt.Errorf("varint can only be used on integers, not %s", t)
+			}
+			ft.varint = true
+		default:
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+	}
+
+	if ft.maxOut != 0 && !ft.compress {
+		return nil, fmt.Errorf("maxout can only be used on compressed fields")
+	}
+	if ft.bits != 0 && (ft.compress || ft.nilPolicy != 0 || ft.wire != 0 || ft.varint || ft.cond != nil) {
+		return nil, fmt.Errorf("bits can not be combined with compress, nil, wire, varint or if")
+	}
+	if ft.lengthField != "" && (ft.compress || ft.nilPolicy != 0 || ft.lengths != lengthDefault || ft.fixedSize != 0 || ft.cstring || ft.cond != nil) {
+		return nil, fmt.Errorf("count and size can not be combined with compress, nil, len, fixed, cstring or if")
+	}
+	if ft.lengths != lengthDefault {
+		if ft.fixedSize != 0 || ft.cstring {
+			return nil, fmt.Errorf("len can not be combined with fixed or cstring")
+		}
+		if k := t.Kind(); !ft.compress && k != reflect.String && k != reflect.Slice && k != reflect.Map {
+			return nil, fmt.Errorf("len can only be used on strings, slices, maps and compressed fields, not %s", t)
+		}
+	}
+	if ft.constant.IsValid() && (ft.compress || ft.nilPolicy != 0 || ft.varint || ft.bits != 0 || ft.cond != nil) {
+		return nil, fmt.Errorf("const can not be combined with compress, nil, varint, bits or if")
+	}
+	if (ft.pad != 0 || ft.align != 0) && ft.bits != 0 {
+		return nil, fmt.Errorf("pad and align can not be combined with bits")
+	}
+	if ft.fixedSize != 0 && ft.cstring {
+		return nil, fmt.Errorf("fixed and cstring can not be combined")
+	}
+	if ft.rest && (ft.compress || ft.nilPolicy != 0 || ft.lengths != lengthDefault || ft.fixedSize != 0 || ft.cstring || ft.lengthField != "") {
+		return nil, fmt.Errorf("rest can not be combined with compress, nil, len, fixed, cstring, count or size")
+	}
+	if (ft.fixedSize != 0 || ft.cstring) && ft.nilPolicy != 0 {
+		return nil, fmt.Errorf("nil can not be used on fixed or cstring fields")
+	}
+	if ft.varint && ft.wire != 0 {
+		return nil, fmt.Errorf("varint and wire can not be combined")
+	}
+
+	return ft, nil
+}
+
+// config returns the config for the field, based on the config of the struct holding it.
+func (ft *fieldTag) config(parent config) config {
+	cfg := parent.elem()
+	cfg.local.nilPolicy = ft.nilPolicy
+	cfg.local.fixedSize = ft.fixedSize
+	cfg.local.cstring = ft.cstring
+	cfg.local.rest = ft.rest
+	cfg.local.lengths = ft.lengths
+	// Unlike the local settings, these apply to all values nested within the field
+	if ft.sorted {
+		cfg.sortMaps = true
+	}
+	if ft.timeUnit != 0 {
+		cfg.timeUnit = ft.timeUnit
+	}
+	if ft.timeZone {
+		cfg.timeZone = true
+	}
+	if ft.text {
+		cfg.textMarshalers = true
+	}
+	if ft.intSize != 0 {
+		cfg.intSize = ft.intSize
+	}
+	if ft.wire != 0 {
+		cfg.wire = ft.wire
+	}
+	if ft.varint {
+		cfg.varint = true
+	}
+	if ft.hasOrder {
+		cfg.order = ft.order
+	}
+	return cfg
+}
+
+// blank reports whether the tag applies to blank (_) fields, which are only packed if it does.
+func (ft *fieldTag) blank() bool {
+	return ft.constant.IsValid() || ft.pad != 0 || ft.align != 0
+}
+
+func isByteString(t reflect.Type) bool {
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
+
+// baseType strips pointers, slices and arrays from t, returning the type of the values they hold.
+func baseType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
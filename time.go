@@ -0,0 +1,119 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// zeroTime is packed in place of the zero time.Time, which can't be represented in unix nanoseconds.
+const zeroTime = math.MinInt64
+
+var (
+	minNanoTime = time.Unix(0, math.MinInt64+1)
+	maxNanoTime = time.Unix(0, math.MaxInt64)
+)
+
+func getTimeHandler(cfg config) readWriter {
+	unit := cfg.timeUnit
+	if unit == 0 {
+		unit = time.Nanosecond
+	}
+
+	return &timeReadWriter{unit: unit, zone: cfg.timeZone, order: cfg.order.byteOrder()}
+}
+
+func parseTimeUnit(s string) (time.Duration, error) {
+	switch s {
+	case "s":
+		return time.Second, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ns":
+		return time.Nanosecond, nil
+	default:
+		return 0, fmt.Errorf("unknown time unit %q", s)
+	}
+}
+
+var _ fixedReadWriter = (*timeReadWriter)(nil)
+
+// timeReadWriter packs time.Time as an int64 amount of units since the unix epoch, optionally followed by the int32
+// zone offset in seconds. Without the zone, times are unpacked in UTC.
+type timeReadWriter struct {
+	fixed
+	unit  time.Duration
+	zone  bool
+	order binary.ByteOrder
+}
+
+func (t *timeReadWriter) length() int {
+	if t.zone {
+		return 12
+	}
+	return 8
+}
+
+func (t *timeReadWriter) readFixed(b []byte, v reflect.Value) error {
+	n := int64(t.order.Uint64(b))
+	if n == zeroTime {
+		v.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+
+	var tm time.Time
+	switch t.unit {
+	case time.Second:
+		tm = time.Unix(n, 0)
+	case time.Millisecond:
+		tm = time.UnixMilli(n)
+	case time.Microsecond:
+		tm = time.UnixMicro(n)
+	default:
+		tm = time.Unix(0, n)
+	}
+
+	if t.zone {
+		tm = tm.In(time.FixedZone("", int(int32(t.order.Uint32(b[8:])))))
+	} else {
+		tm = tm.UTC()
+	}
+
+	v.Set(reflect.ValueOf(tm))
+	return nil
+}
+
+func (t *timeReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	tm := v.Interface().(time.Time)
+
+	var n int64
+	switch {
+	case tm.IsZero():
+		n = zeroTime
+	case t.unit == time.Second:
+		n = tm.Unix()
+	case t.unit == time.Millisecond:
+		n = tm.UnixMilli()
+	case t.unit == time.Microsecond:
+		n = tm.UnixMicro()
+	default:
+		if tm.Before(minNanoTime) || tm.After(maxNanoTime) {
+			return fmt.Errorf("time %s can not be represented in unix nanoseconds", tm)
+		}
+		n = tm.UnixNano()
+	}
+	t.order.PutUint64(b, uint64(n))
+
+	if t.zone {
+		_, offset := tm.Zone()
+		t.order.PutUint32(b[8:], uint32(int32(offset)))
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package ikea
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	type timed struct {
+		At      time.Time
+		Seconds time.Time   `ikea:"time:s"`
+		Zoned   time.Time   `ikea:"time:ms,zone"`
+		Times   []time.Time `ikea:"time:s"`
+		Zero    time.Time
+		Timeout time.Duration
+	}
+
+	zone := time.FixedZone("", -7*3600)
+	now := time.Now() // Has a monotonic clock reading, which is not packed
+	value := &timed{
+		At:      now,
+		Seconds: time.Unix(1500000000, 123),
+		Zoned:   time.Date(2020, 2, 3, 4, 5, 6, 7000000, zone),
+		Times:   []time.Time{time.Unix(1, 0), time.Unix(2, 0)},
+		Timeout: 1500 * time.Millisecond,
+	}
+
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(data) != 8+8+12+4+2*8+8+8 {
+		t.Errorf("Failing TestTime, unexpected packed size %d", len(data))
+	}
+	if !bytes.Equal(data[8:16], []byte{0, 0, 0, 0, 0x59, 0x68, 0x2f, 0}) {
+		t.Errorf("Failing TestTime, expected the seconds since the epoch, got %x", data[8:16])
+	}
+
+	result := new(timed)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !result.At.Equal(now) || result.At.Location() != time.UTC || result.At != now.Round(0).UTC() {
+		t.Errorf("Failing TestTime, expected %v in UTC, got %v", now, result.At)
+	}
+	if !result.Seconds.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("Failing TestTime, expected the time to be truncated to seconds, got %v", result.Seconds)
+	}
+	if !result.Zoned.Equal(value.Zoned) {
+		t.Errorf("Failing TestTime, expected %v, got %v", value.Zoned, result.Zoned)
+	}
+	if _, offset := result.Zoned.Zone(); offset != -7*3600 {
+		t.Errorf("Failing TestTime, expected the zone offset to be retained, got %d", offset)
+	}
+	if len(result.Times) != 2 || !result.Times[1].Equal(time.Unix(2, 0)) {
+		t.Errorf("Failing TestTime, unexpected times %v", result.Times)
+	}
+	if !result.Zero.IsZero() {
+		t.Errorf("Failing TestTime, expected the zero time, got %v", result.Zero)
+	}
+	if result.Timeout != value.Timeout {
+		t.Errorf("Failing TestTime, expected %v, got %v", value.Timeout, result.Timeout)
+	}
+}
+
+func TestTimeOutOfRange(t *testing.T) {
+	type timed struct {
+		At time.Time
+	}
+
+	var fe *FieldError
+	far := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Marshal(&timed{At: far}); !errors.As(err, &fe) || fe.Path != "timed.At" {
+		t.Errorf("Failing TestTimeOutOfRange, expected a field error on At, got %v", err)
+	}
+
+	type coarse struct {
+		At time.Time `ikea:"time:ms"`
+	}
+	data, err := Marshal(&coarse{At: far})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result := new(coarse)
+	if err := Unmarshal(data, result); err != nil || !result.At.Equal(far) {
+		t.Errorf("Failing TestTimeOutOfRange, expected %v, got %v (%v)", far, result.At, err)
+	}
+
+	type invalid struct {
+		At time.Time `ikea:"time:h"`
+	}
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(invalid{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestTimeOutOfRange, expected an invalid tag error, got %v", err)
+	}
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(struct {
+			At int64 `ikea:"time:ms"`
+		}{}),
+		reflect.TypeOf(struct {
+			At []string `ikea:"zone"`
+		}{}),
+	} {
+		if err := Check(typ); !errors.As(err, &te) {
+			t.Errorf("Failing TestTimeOutOfRange, expected %s to be rejected, got %v", typ, err)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package ikea
 
 import (
 	"fmt"
-	"io"
 	"reflect"
 )
 
@@ -15,46 +14,87 @@ type fixedReadWriter interface {
 
 	length() int
 
-	readFixed([]byte, reflect.Value)
+	readFixed([]byte, reflect.Value) error
 
-	writeFixed([]byte, reflect.Value)
+	writeFixed([]byte, reflect.Value) error
 }
 
 type variableReadWriter interface {
 	readWriter
 
-	vLength(reflect.Value) int
+	vLength(reflect.Value) (int, error)
 
-	readVariable(io.Reader, reflect.Value) error
+	readVariable(*reader, reflect.Value) error
 
-	writeVariable(io.Writer, reflect.Value) error
+	writeVariable(*writer, reflect.Value) error
 }
 
-func getTypeHandler(typ reflect.Type) readWriter {
+// handlerKey identifies a cached handler, as the same type can be packed differently depending on its config.
+type handlerKey struct {
+	typ reflect.Type
+	cfg config
+}
+
+func getTypeHandler(typ reflect.Type, cfg config) (readWriter, error) {
 	kind := typ.Kind()
 
-	if primitive, ok := primitiveIndex[kind]; ok {
-		return primitive
+	if cfg.lengths == lengthInvalid {
+		return nil, &UnsupportedTypeError{Type: typ, Hint: fmt.Sprintf("invalid length size %d, use 8, 16, 32 or 64", cfg.lengthBits)}
+	}
+
+	// time.Time implements encoding.BinaryMarshaler too, but is packed as a plain int64 instead
+	if typ == timeType {
+		return getTimeHandler(cfg), nil
+	}
+	if marshaler := getMarshalerHandler(typ, cfg); marshaler != nil {
+		return withOpaquePadding(marshaler, cfg), nil
+	}
+	if h := getXDRHandler(typ, cfg); h != nil {
+		return h, nil
+	}
+
+	if primitive, ok := primitiveIndex[cfg.order][kind]; ok {
+		if cfg.varint && isInteger(kind) {
+			return varintHandler, nil
+		}
+		if cfg.wire != 0 && isInteger(kind) {
+			return getWireHandler(cfg), nil
+		}
+		return primitive, nil
 	}
 
 	switch kind {
 	case reflect.Ptr:
-		return getPointerHandlerFromType(typ)
+		return getPointerHandlerFromType(typ, cfg)
 	case reflect.String:
-		return stringTypeHandler
+		if h := getByteStringHandler(typ, cfg); h != nil {
+			return withOpaquePadding(h, cfg), nil
+		}
+		return withOpaquePadding(&stringReadWriter{prefix: cfg.prefix()}, cfg), nil
 	case reflect.Struct:
-		return getStructHandlerFromType(typ)
+		if isOptional(typ) {
+			return getOptionalHandlerFromType(typ, cfg)
+		}
+		return getStructHandlerFromType(typ, cfg)
 	case reflect.Slice:
-		return getSliceHandlerFromType(typ)
+		if h := getByteStringHandler(typ, cfg); h != nil {
+			return withOpaquePadding(h, cfg), nil
+		}
+		h, err := getSliceHandlerFromType(typ, cfg)
+		if err != nil || typ.Elem().Kind() != reflect.Uint8 {
+			return h, err
+		}
+		return withOpaquePadding(h, cfg), nil // Byte slices are variable-length opaque data
+	case reflect.Array:
+		return getArrayHandlerFromType(typ, cfg)
 	case reflect.Map:
-		return getMapHandlerFromType(typ)
-	case reflect.Uint:
-		fallthrough
-	case reflect.Int:
-		panic("types uint and int are not supported, as their actual size is dependant on compiler architecture and" +
-			" could cause data inconsistencies. use uint32/uint64/int32/int64 instead")
+		return getMapHandlerFromType(typ, cfg)
+	case reflect.Interface:
+		return getInterfaceHandlerFromType(typ, cfg)
+	case reflect.Uint, reflect.Int:
+		return getIntHandlerFromType(typ, cfg)
 	default:
-		panic(fmt.Sprintf("Cannot build type handler for type \"%s\" with kind nr. %d", typ.String(), typ.Kind()))
+		return nil, &UnsupportedTypeError{Type: typ}
 	}
 }
 
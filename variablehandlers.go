@@ -1,19 +1,20 @@
 package ikea
 
 import (
-	"io"
 	"reflect"
 )
 
-func handleVariableReader(r io.Reader, h readWriter, v reflect.Value) error {
+func handleVariableReader(r *reader, h readWriter, v reflect.Value) error {
 	if h.isFixed() {
 		hr := h.(fixedReadWriter)
-		b := make([]byte, hr.length())
-		if _, err := io.ReadFull(r, b); err != nil {
+		b, err := r.next(hr.length())
+		if err != nil {
 			return err
 		}
 
-		hr.readFixed(b, v)
+		if err := hr.readFixed(b, v); err != nil {
+			return offsetFieldError(err, r.n-int64(len(b)))
+		}
 	} else {
 		hr := h.(variableReadWriter)
 		if err := hr.readVariable(r, v); err != nil {
@@ -24,11 +25,13 @@ func handleVariableReader(r io.Reader, h readWriter, v reflect.Value) error {
 	return nil
 }
 
-func handleVariableWriter(w io.Writer, h readWriter, v reflect.Value) error {
+func handleVariableWriter(w *writer, h readWriter, v reflect.Value) error {
 	if h.isFixed() {
 		hw := h.(fixedReadWriter)
-		b := make([]byte, hw.length())
-		hw.writeFixed(b, v)
+		b := w.scratch(hw.length())
+		if err := hw.writeFixed(b, v); err != nil {
+			return offsetFieldError(err, w.n)
+		}
 
 		if _, err := w.Write(b); err != nil {
 			return err
@@ -43,9 +46,9 @@ func handleVariableWriter(w io.Writer, h readWriter, v reflect.Value) error {
 	return nil
 }
 
-func handleVariableLength(h readWriter, v reflect.Value) int {
+func handleVariableLength(h readWriter, v reflect.Value) (int, error) {
 	if h.isFixed() {
-		return h.(fixedReadWriter).length()
+		return h.(fixedReadWriter).length(), nil
 	}
 
 	// variable
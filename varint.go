@@ -0,0 +1,81 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+var varintHandler = new(varintReadWriter)
+
+var _ variableReadWriter = (*varintReadWriter)(nil)
+
+// varintReadWriter packs integers as unsigned varints, signed integers are zigzag encoded first so small negative
+// values remain small.
+type varintReadWriter struct {
+	variable
+}
+
+func (h *varintReadWriter) readVariable(r *reader, v reflect.Value) error {
+	u, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+
+	if isSigned(v.Kind()) {
+		n := int64(u>>1) ^ -int64(u&1)
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	}
+
+	if v.OverflowUint(u) {
+		return fmt.Errorf("%w: %d does not fit in %s", ErrOverflow, u, v.Type())
+	}
+	v.SetUint(u)
+	return nil
+}
+
+func (h *varintReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	return w.writeUvarint(varintValue(v))
+}
+
+func (h *varintReadWriter) vLength(v reflect.Value) (int, error) {
+	return uvarintSize(varintValue(v)), nil
+}
+
+// varintValue returns the unsigned value to pack for v, zigzag encoding signed integers.
+func varintValue(v reflect.Value) uint64 {
+	if isSigned(v.Kind()) {
+		n := v.Int()
+		return uint64(n<<1) ^ uint64(n>>63)
+	}
+	return v.Uint()
+}
+
+func uvarintSize(x uint64) int {
+	size := 1
+	for ; x >= 0x80; x >>= 7 {
+		size++
+	}
+	return size
+}
+
+// ReadByte allows the reader to be used with binary.ReadUvarint.
+func (r *reader) ReadByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (w *writer) writeUvarint(x uint64) error {
+	b := w.scratch(binary.MaxVarintLen64)
+	n := binary.PutUvarint(b, x)
+
+	_, err := w.Write(b[:n])
+	return err
+}
@@ -0,0 +1,196 @@
+package ikea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	type compact struct {
+		A int64   `ikea:"varint"`
+		B uint32  `ikea:"varint"`
+		C []int16 `ikea:"varint"`
+		D int     `ikea:"varint"`
+		E uint8
+	}
+
+	value := &compact{A: -1, B: 300, C: []int16{1, -2, math.MinInt16}, D: 64, E: 5}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{0x01, 0xac, 0x02, 0, 0, 0, 3, 0x02, 0x03, 0xff, 0xff, 0x03, 0x80, 0x01, 5}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestVarint, expected %x, got %x", expected, data)
+	}
+	if l, err := Len(value); err != nil || l != len(expected) {
+		t.Errorf("Failing TestVarint, Len reported %d, should be %d (%v)", l, len(expected), err)
+	}
+
+	result := new(compact)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestVarint, expected %+v, got %+v", value, result)
+	}
+
+	// 0x80 0x04 is 512, which doesn't fit in the uint8
+	var small struct {
+		A uint8 `ikea:"varint"`
+	}
+	if err := Unmarshal([]byte{0x80, 0x04}, &small); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Failing TestVarint, expected an overflow, got %v", err)
+	}
+	if err := Unmarshal([]byte{0x80}, &small); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Failing TestVarint, expected an unexpected EOF, got %v", err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		A int64 `ikea:"varint,wire:uint8"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestVarint, expected varint and wire to be rejected, got %v", err)
+	}
+}
+
+func TestVarintLengths(t *testing.T) {
+	type lengths struct {
+		S string
+		B []byte
+		M map[string]uint8
+		C []byte `ikea:"compress"`
+	}
+
+	value := &lengths{S: "abc", B: bytes.Repeat([]byte{1}, 200), M: map[string]uint8{"a": 1}, C: []byte("compressed")}
+	data, err := Marshal(value, VarintLengths())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data[:6], []byte{3, 'a', 'b', 'c', 0xc8, 0x01}) {
+		t.Errorf("Failing TestVarintLengths, expected varint prefixes, got %x", data[:6])
+	}
+	if l, err := Len(value, VarintLengths()); err != nil || l != len(data) {
+		t.Errorf("Failing TestVarintLengths, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(lengths)
+	if err := Unmarshal(data, result, VarintLengths()); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestVarintLengths, expected %+v, got %+v", value, result)
+	}
+
+	if err := Unmarshal(data, new(lengths), VarintLengths(), MaxStringLength(2)); !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("Failing TestVarintLengths, expected the string limit to apply, got %v", err)
+	}
+
+	huge := append([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, strings.Repeat("a", 10)...)
+	if err := Unmarshal(huge, new(string), VarintLengths()); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Failing TestVarintLengths, expected the length to be rejected, got %v", err)
+	}
+}
+
+func TestLengthSize(t *testing.T) {
+	type prefixed struct {
+		Name  string            `ikea:"len:uint8"`
+		Items []uint16          `ikea:"len:uint16"`
+		Tags  map[string]uint8  `ikea:"len:varint"`
+		Blob  []byte            `ikea:"len:uint64"`
+		Deep  []string          `ikea:"len:uint8"` // Only the outer slice is affected
+		Other map[uint8][]uint8 // Uses the default
+	}
+
+	value := &prefixed{
+		Name:  "abc",
+		Items: []uint16{1},
+		Tags:  map[string]uint8{},
+		Blob:  []byte{9},
+		Deep:  []string{"d"},
+		Other: map[uint8][]uint8{},
+	}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{
+		3, 'a', 'b', 'c',
+		0, 1, 0, 1,
+		0,
+		0, 0, 0, 0, 0, 0, 0, 1, 9,
+		1, 0, 0, 0, 1, 'd',
+		0, 0, 0, 0,
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestLengthSize, expected %x, got %x", expected, data)
+	}
+
+	result := new(prefixed)
+	if err := Unmarshal(data, result); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestLengthSize, expected %+v, got %+v", value, result)
+	}
+
+	var fe *FieldError
+	value.Name = strings.Repeat("a", 256)
+	if _, err := Len(value); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Path != "prefixed.Name" {
+		t.Errorf("Failing TestLengthSize, expected Len to report an overflow of Name, got %v", err)
+	}
+	if err := Pack(new(bytes.Buffer), value); !errors.Is(err, ErrOverflow) || !errors.As(err, &fe) || fe.Path != "prefixed.Name" {
+		t.Errorf("Failing TestLengthSize, expected an overflow of Name, got %v", err)
+	}
+
+	// Hostile 64 bit lengths are rejected before anything is allocated
+	huge := []byte{0x20, 0, 0, 0, 0, 0, 0, 0}
+	var numbers []uint64
+	if err := Unmarshal(huge, &numbers, LengthSize(64)); err == nil {
+		t.Error("Failing TestLengthSize, expected a length of 1<<61 to be rejected")
+	}
+	var text string
+	if err := Unmarshal(huge, &text, LengthSize(64)); err == nil {
+		t.Error("Failing TestLengthSize, expected a string length of 1<<61 to be rejected")
+	}
+	var blocks [][1 << 20]byte
+	if err := Unmarshal([]byte{0, 0, 0, 0, 0, 0, 0x10, 0}, &blocks, LengthSize(64)); err == nil {
+		t.Error("Failing TestLengthSize, expected 4GiB of elements to be rejected")
+	}
+
+	for _, size := range []lengthSize{lengthUint32, lengthUint64, lengthVarint} {
+		prefix := lengthPrefix{size: size, order: binary.BigEndian}
+		if _, err := prefix.bytes(math.MaxInt32 + 1); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Failing TestLengthSize, expected a %s prefix to refuse lengths beyond math.MaxInt32, got %v", prefix, err)
+		}
+	}
+
+	var ue *UnsupportedTypeError
+	if _, err := Marshal([]string{"a"}, LengthSize(24)); !errors.As(err, &ue) {
+		t.Errorf("Failing TestLengthSize, expected an invalid size to be reported, got %v", err)
+	}
+
+	data, err = Marshal([]string{"a"}, LengthSize(16))
+	if err != nil || !bytes.Equal(data, []byte{0, 1, 0, 1, 'a'}) {
+		t.Errorf("Failing TestLengthSize, expected 16 bit prefixes, got %x (%v)", data, err)
+	}
+
+	var te *InvalidTagError
+	if err := Check(reflect.TypeOf(struct {
+		A uint32 `ikea:"len:uint8"`
+	}{})); !errors.As(err, &te) {
+		t.Errorf("Failing TestLengthSize, expected len on a uint32 to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package ikea
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// opaquePadding returns the amount of zero bytes packed after n bytes of opaque data, which XDR pads to a multiple of
+// 4 bytes.
+func (c config) opaquePadding(n int) int {
+	if !c.xdr {
+		return 0
+	}
+	return (4 - n%4) % 4
+}
+
+// presenceSize returns the size of presence flags, which are packed as bools.
+func (c config) presenceSize() int {
+	if c.xdr {
+		return 4
+	}
+	return 1
+}
+
+// getXDRHandler returns the handler for types that are packed differently in XDR mode, or nil if t is not one of them.
+func getXDRHandler(t reflect.Type, cfg config) readWriter {
+	if !cfg.xdr {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &xdrBoolReadWriter{order: cfg.order.byteOrder()}
+	case reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+		if cfg.varint || cfg.wire != 0 {
+			return nil // Explicitly set by a tag
+		}
+		cfg.wire = reflect.Int32
+		if !isSigned(t.Kind()) {
+			cfg.wire = reflect.Uint32
+		}
+		return getWireHandler(cfg)
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &fixedOpaqueReadWriter{size: t.Len(), pad: cfg.opaquePadding(t.Len())}
+		}
+	}
+
+	return nil
+}
+
+// withOpaquePadding wraps variable handler h to pad its packed form to a multiple of 4 bytes in XDR mode.
+func withOpaquePadding(h readWriter, cfg config) readWriter {
+	if !cfg.xdr || h.isFixed() {
+		return h
+	}
+	if _, ok := h.(*restReadWriter); ok {
+		return h // Runs until the end, so there is nothing to pad to
+	}
+	return &opaquePaddingReadWriter{handler: h.(variableReadWriter)}
+}
+
+var _ fixedReadWriter = (*xdrBoolReadWriter)(nil)
+
+// xdrBoolReadWriter packs bools as a 4 byte integer that is either 0 or 1.
+type xdrBoolReadWriter struct {
+	fixed
+	order binary.ByteOrder
+}
+
+func (x *xdrBoolReadWriter) length() int {
+	return 4
+}
+
+func (x *xdrBoolReadWriter) readFixed(b []byte, v reflect.Value) error {
+	switch n := x.order.Uint32(b); n {
+	case 0, 1:
+		v.SetBool(n == 1)
+		return nil
+	default:
+		return fmt.Errorf("invalid bool %d", n)
+	}
+}
+
+func (x *xdrBoolReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	var n uint32
+	if v.Bool() {
+		n = 1
+	}
+	x.order.PutUint32(b, n)
+	return nil
+}
+
+var _ fixedReadWriter = (*fixedOpaqueReadWriter)(nil)
+
+// fixedOpaqueReadWriter packs byte arrays as XDR fixed-length opaque data, which is followed by pad zero bytes.
+type fixedOpaqueReadWriter struct {
+	fixed
+	size int
+	pad  int
+}
+
+func (o *fixedOpaqueReadWriter) length() int {
+	return o.size + o.pad
+}
+
+func (o *fixedOpaqueReadWriter) readFixed(b []byte, v reflect.Value) error {
+	for i := 0; i < o.size; i++ {
+		v.Index(i).SetUint(uint64(b[i]))
+	}
+	return nil
+}
+
+func (o *fixedOpaqueReadWriter) writeFixed(b []byte, v reflect.Value) error {
+	for i := 0; i < o.size; i++ {
+		b[i] = byte(v.Index(i).Uint())
+	}
+	for i := o.size; i < len(b); i++ {
+		b[i] = 0
+	}
+	return nil
+}
+
+var _ variableReadWriter = (*opaquePaddingReadWriter)(nil)
+
+// opaquePaddingReadWriter pads the packed form of strings and other variable-length opaque data with zero bytes, up to
+// a multiple of 4 bytes. The padding is skipped when unpacking.
+type opaquePaddingReadWriter struct {
+	variable
+	handler variableReadWriter
+}
+
+func (o *opaquePaddingReadWriter) readVariable(r *reader, v reflect.Value) error {
+	start := r.n
+	if err := o.handler.readVariable(r, v); err != nil {
+		return err
+	}
+
+	if pad := (4 - (r.n-start)%4) % 4; pad > 0 {
+		if _, err := r.next(int(pad)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *opaquePaddingReadWriter) writeVariable(w *writer, v reflect.Value) error {
+	start := w.n
+	if err := o.handler.writeVariable(w, v); err != nil {
+		return err
+	}
+
+	if pad := (4 - (w.n-start)%4) % 4; pad > 0 {
+		if _, err := w.Write(w.scratch(int(pad))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *opaquePaddingReadWriter) vLength(v reflect.Value) (int, error) {
+	l, err := o.handler.vLength(v)
+	return l + (4-l%4)%4, err
+}
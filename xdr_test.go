@@ -0,0 +1,86 @@
+package ikea
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestXDR(t *testing.T) {
+	type record struct {
+		Flag  bool
+		Small int16
+		Name  string
+		Data  []byte
+		Key   [3]byte
+		Opt   *uint32 `ikea:"nil:presence"`
+		Tag   string  `ikea:"fixed:5"`
+		Count uint32
+	}
+
+	value := &record{Flag: true, Small: -2, Name: "abcde", Data: []byte{1}, Key: [3]byte{7, 8, 9}, Tag: "xy", Count: 5}
+	data, err := Marshal(value, XDR())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []byte{
+		0, 0, 0, 1, // Flag
+		0xFF, 0xFF, 0xFF, 0xFE, // Small
+		0, 0, 0, 5, 'a', 'b', 'c', 'd', 'e', 0, 0, 0, // Name
+		0, 0, 0, 1, 1, 0, 0, 0, // Data
+		7, 8, 9, 0, // Key
+		0, 0, 0, 0, // Opt
+		'x', 'y', 0, 0, 0, 0, 0, 0, // Tag
+		0, 0, 0, 5, // Count
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Failing TestXDR, expected %x, got %x", expected, data)
+	}
+	if l, err := Len(value, XDR()); err != nil || l != len(data) {
+		t.Errorf("Failing TestXDR, Len reported %d, should be %d (%v)", l, len(data), err)
+	}
+
+	result := new(record)
+	if err := Unmarshal(data, result, XDR()); err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(result, value) {
+		t.Errorf("Failing TestXDR, expected %+v, got %+v", value, result)
+	}
+
+	opt := uint32(3)
+	value.Opt = &opt
+	if data, err = Marshal(value, XDR()); err != nil || !bytes.Equal(data[32:40], []byte{0, 0, 0, 1, 0, 0, 0, 3}) {
+		t.Errorf("Failing TestXDR, expected a 4 byte presence flag, got %x (%v)", data, err)
+	}
+
+	// Bools must be 0 or 1
+	data[3] = 2
+	if err := Unmarshal(data, result, XDR()); err == nil {
+		t.Error("Failing TestXDR, expected an invalid bool to be rejected")
+	}
+}
+
+func TestXDRFixed(t *testing.T) {
+	type fixedRecord struct {
+		A bool
+		B [2]byte
+		C uint8
+	}
+
+	h, err := getTypeHandler(reflect.TypeOf(fixedRecord{}), newOptions([]Option{XDR()}).cfg)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !h.isFixed() || h.(fixedReadWriter).length() != 12 {
+		t.Errorf("Failing TestXDRFixed, expected a fixed handler of 12 bytes, got %T", h)
+	}
+
+	// Without XDR, the format is unchanged
+	if l, err := Len(&fixedRecord{}); err != nil || l != 4 {
+		t.Errorf("Failing TestXDRFixed, expected 4 bytes without XDR, got %d (%v)", l, err)
+	}
+}